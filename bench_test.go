@@ -1,7 +1,10 @@
 package restruct
 
 import (
+	"context"
 	"net/http"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -47,13 +50,16 @@ func BenchmarkHandlerStatic(b *testing.B) {
 	}
 }
 
+// Params are kept in one request state under a single context key instead
+// of param maps and a context value each, before this it was 1539 ns/op,
+// 1120 B/op, 9 allocs/op. The state isn't pooled as the request context can
+// outlive the handler.
 // goos: linux
 // goarch: amd64
 // pkg: github.com/altlimit/restruct
-// cpu: Intel(R) Core(TM) i7-3770K CPU @ 3.50GHz
-// BenchmarkHandlerWithParam-8   	 1180539	       983.0 ns/op	     856 B/op	       9 allocs/op
+// cpu: Intel(R) Xeon(R) Processor
+// BenchmarkHandlerWithParam   	 1221220	      1010 ns/op	     608 B/op	       5 allocs/op
 // PASS
-// ok  	github.com/altlimit/restruct	2.055s
 func BenchmarkHandlerWithParam(b *testing.B) {
 	h := NewHandler(&testService2{})
 	h.mustCompile("/api/v1")
@@ -118,3 +124,108 @@ func BenchmarkMatch(b *testing.B) {
 		matchPath(paramCache{path: m.path, pathParts: m.pathParts}, "catch/hello")
 	}
 }
+
+type testService5 struct{}
+
+func (ts *testService5) Hello_0(r *http.Request) {}
+
+func (ts *testService5) Middlewares() []Middleware {
+	return []Middleware{benchMiddleware}
+}
+
+func benchMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Middleware chains are built once per route instead of on every request,
+// before this it was 2186 ns/op, 1288 B/op, 17 allocs/op.
+// goos: linux
+// goarch: amd64
+// pkg: github.com/altlimit/restruct
+// BenchmarkHandlerMiddlewares   	  710791	      1597 ns/op	    1096 B/op	       8 allocs/op
+// PASS
+func BenchmarkHandlerMiddlewares(b *testing.B) {
+	h := NewHandler(&testService5{})
+	h.mustCompile("/api/v1")
+	h.Use(benchMiddleware, benchMiddleware)
+
+	request, _ := http.NewRequest("GET", "/api/v1/hello/1", nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		h.ServeHTTP(nil, request)
+	}
+}
+
+type discardWriter struct{ header http.Header }
+
+func (d *discardWriter) Header() http.Header         { return d.header }
+func (d *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d *discardWriter) WriteHeader(int)             {}
+
+type testService6 struct{}
+
+func (ts *testService6) Init(h *Handler) {
+	h.PathArgs = true
+}
+
+func (ts *testService6) Hello_0(ctx context.Context, id int) (int, error) {
+	return id, nil
+}
+
+func (ts *testService6) Routes() []Route {
+	return []Route{
+		{Handler: "Hello_0"},
+		{Path: "typed/{id}", Handler: Func(func(ctx context.Context, id int) (int, error) {
+			return id, nil
+		})},
+	}
+}
+
+// testService7 has an invoker like the ones restructgen generates
+type testService7 struct{}
+
+func (ts *testService7) Init(h *Handler) {
+	h.PathArgs = true
+}
+
+func (ts *testService7) Hello_0(ctx context.Context, id int) (int, error) {
+	return id, nil
+}
+
+func init() {
+	RegisterInvoker("Hello_0", func(recv *testService7, args []reflect.Value) []reflect.Value {
+		a0, _ := args[0].Interface().(context.Context)
+		a1, _ := args[1].Interface().(int)
+		r0, r1 := recv.Hello_0(a0, a1)
+		return []reflect.Value{reflect.ValueOf(&r0).Elem(), reflect.ValueOf(&r1).Elem()}
+	})
+}
+
+// goos: linux
+// goarch: amd64
+// pkg: github.com/altlimit/restruct
+// cpu: Intel(R) Xeon(R) Processor
+// BenchmarkHandlerCall/reflect     	  749298	      1690 ns/op	     656 B/op	      12 allocs/op
+// BenchmarkHandlerCall/typed       	  974044	      1440 ns/op	     648 B/op	      12 allocs/op
+// BenchmarkHandlerCall/generated   	  856609	      1336 ns/op	     648 B/op	      12 allocs/op
+func BenchmarkHandlerCall(b *testing.B) {
+	h := NewHandler(&testService6{})
+	gen := NewHandler(&testService7{})
+	w := &discardWriter{header: http.Header{}}
+	for _, path := range []string{"reflect:/hello/1", "typed:/typed/1", "generated:/hello/1"} {
+		name, p, _ := strings.Cut(path, ":")
+		request, _ := http.NewRequest("GET", p, nil)
+		h := h
+		if name == "generated" {
+			h = gen
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				h.ServeHTTP(w, request)
+			}
+		})
+	}
+}
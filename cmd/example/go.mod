@@ -4,17 +4,4 @@ go 1.24.0
 
 replace github.com/altlimit/restruct => ../../
 
-require (
-	github.com/altlimit/restruct v0.0.0-20220616021605-5da3fb060604
-	github.com/go-playground/validator/v10 v10.30.1
-)
-
-require (
-	github.com/gabriel-vasile/mimetype v1.4.12 // indirect
-	github.com/go-playground/locales v0.14.1 // indirect
-	github.com/go-playground/universal-translator v0.18.1 // indirect
-	github.com/leodido/go-urn v1.4.0 // indirect
-	golang.org/x/crypto v0.46.0 // indirect
-	golang.org/x/sys v0.39.0 // indirect
-	golang.org/x/text v0.32.0 // indirect
-)
+require github.com/altlimit/restruct v0.0.0-20220616021605-5da3fb060604
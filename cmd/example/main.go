@@ -12,12 +12,10 @@ import (
 	"log/slog"
 	"mime/multipart"
 	"net/http"
-	"reflect"
 	"regexp"
 	"strings"
 
 	rs "github.com/altlimit/restruct"
-	"github.com/go-playground/validator/v10"
 )
 
 //go:embed public
@@ -25,8 +23,6 @@ var publicFS embed.FS
 
 type (
 	V1 struct {
-		validate *validator.Validate
-
 		User  User `route:"users"`
 		Blobs Blob
 	}
@@ -62,40 +58,6 @@ func getUser(r *http.Request) (int64, error) {
 	return 0, errAuth
 }
 
-// Register custom tags for validator
-func registerValidatorTags(v *validator.Validate) {
-	v.RegisterTagNameFunc(func(fld reflect.StructField) string {
-		tags := []string{"json", "query"}
-		for _, tag := range tags {
-			name := strings.SplitN(fld.Tag.Get(tag), ",", 2)[0]
-			if name != "-" && name != "" {
-				return name
-			}
-		}
-		return fld.Name
-	})
-}
-
-// extending bind to support validation with go validator
-func (v *V1) bind(r *http.Request, src interface{}, methods ...string) error {
-	// we still use default bind but add in our custom validator library below
-	if err := rs.Bind(r, src, methods...); err != nil {
-		return err
-	}
-	if src == nil {
-		return nil
-	}
-	if err := v.validate.Struct(src); err != nil {
-		valErrors := make(map[string]string)
-		for _, err := range err.(validator.ValidationErrors) {
-			valErrors[err.Namespace()] = err.Tag()
-		}
-		return rs.Error{Status: http.StatusBadRequest, Message: "validation error", Data: valErrors}
-	}
-
-	return nil
-}
-
 func (s *Server) Docs() *rs.Response {
 	b, _ := json.Marshal(s.docs)
 	return &rs.Response{
@@ -341,8 +303,6 @@ func (*Server) Routes() []rs.Route {
 
 func (s *Server) Init(h *rs.Handler) {
 	s.docs = h.Routes()
-	// still defaultreader but used our bind to add validation errors
-	h.Reader = &rs.DefaultReader{Bind: s.Api.bind}
 	h.Writer = &rs.DefaultWriter{ErrorHandler: func(err error) any {
 		return map[string]interface{}{
 			"message": "internal error",
@@ -373,10 +333,8 @@ func (s *Server) Some_0(ctx context.Context) (*rs.Render, error) {
 }
 
 func main() {
-	val := validator.New()
-	registerValidatorTags(val)
-
-	rs.Handle("/", &Server{Api: V1{validate: val}})
+	// request structs are checked with their validate tags by the DefaultReader
+	rs.Handle("/", &Server{})
 	port := "8090"
 	slog.Info("Listening", "port", port)
 	http.ListenAndServe(":"+port, nil)
@@ -0,0 +1,306 @@
+// Command restructgen generates typed invokers for restruct services so
+// handlers are called without reflect.Call. Add to a package with services:
+//
+//	//go:generate go run github.com/altlimit/restruct/cmd/restructgen -type User,Admin
+//
+// Without -type every exported struct with exported methods is included.
+// The invokers are registered in an init func of the generated file.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// methods of restruct interfaces that are never routes
+var skipMethods = map[string]bool{
+	"Routes": true, "Middlewares": true, "Init": true, "Writer": true,
+	"Metadata": true, "NameMapper": true, "APIVersion": true,
+}
+
+var majorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+type (
+	methodInfo struct {
+		recv    string // receiver type name
+		pointer bool
+		name    string
+		params  []string
+		results int
+	}
+
+	generator struct {
+		fset    *token.FileSet
+		pkg     string
+		types   map[string]bool
+		methods []methodInfo
+		imports map[string]string // name to path
+	}
+)
+
+func main() {
+	typeNames := flag.String("type", "", "comma separated service types, default all exported structs")
+	output := flag.String("o", "restruct_invokers.go", "output file name")
+	flag.Parse()
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+	var types []string
+	if *typeNames != "" {
+		types = strings.Split(*typeNames, ",")
+	}
+	src, err := generate(dir, *output, types)
+	if err != nil {
+		log.Fatal("restructgen: ", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, *output), src, 0o644); err != nil {
+		log.Fatal("restructgen: ", err)
+	}
+}
+
+// generate parses the package in dir and returns the formatted invokers file
+func generate(dir, output string, types []string) ([]byte, error) {
+	g := &generator{
+		fset:    token.NewFileSet(),
+		imports: make(map[string]string),
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []*ast.File
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") || name == output {
+			continue
+		}
+		f, err := parser.ParseFile(g.fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		if g.pkg == "" {
+			g.pkg = f.Name.Name
+		}
+		files = append(files, f)
+	}
+	if g.pkg == "" {
+		return nil, fmt.Errorf("no go files in %s", dir)
+	}
+
+	g.types = make(map[string]bool)
+	for _, t := range types {
+		g.types[strings.TrimSpace(t)] = true
+	}
+	if len(types) == 0 {
+		for _, f := range files {
+			for _, decl := range f.Decls {
+				gd, ok := decl.(*ast.GenDecl)
+				if !ok || gd.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gd.Specs {
+					ts := spec.(*ast.TypeSpec)
+					if _, ok := ts.Type.(*ast.StructType); ok && ts.Name.IsExported() && ts.TypeParams == nil {
+						g.types[ts.Name.Name] = true
+					}
+				}
+			}
+		}
+	}
+	for _, f := range files {
+		if err := g.collect(f); err != nil {
+			return nil, err
+		}
+	}
+	return g.render()
+}
+
+// collect adds the exported methods of the service types declared in f
+func (g *generator) collect(f *ast.File) error {
+	for _, decl := range f.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || fd.Recv == nil || !fd.Name.IsExported() || skipMethods[fd.Name.Name] {
+			continue
+		}
+		mi := methodInfo{name: fd.Name.Name}
+		recv := fd.Recv.List[0].Type
+		if star, ok := recv.(*ast.StarExpr); ok {
+			mi.pointer = true
+			recv = star.X
+		}
+		ident, ok := recv.(*ast.Ident)
+		if !ok || !g.types[ident.Name] {
+			// generic receivers are skipped
+			continue
+		}
+		mi.recv = ident.Name
+		variadic := false
+		for _, p := range fd.Type.Params.List {
+			if _, ok := p.Type.(*ast.Ellipsis); ok {
+				variadic = true
+				break
+			}
+			typ, err := g.typeString(f, p.Type)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", mi.recv, mi.name, err)
+			}
+			n := len(p.Names)
+			if n == 0 {
+				n = 1
+			}
+			for i := 0; i < n; i++ {
+				mi.params = append(mi.params, typ)
+			}
+		}
+		if variadic {
+			continue
+		}
+		if fd.Type.Results != nil {
+			for _, r := range fd.Type.Results.List {
+				if len(r.Names) == 0 {
+					mi.results++
+				} else {
+					mi.results += len(r.Names)
+				}
+			}
+		}
+		g.methods = append(g.methods, mi)
+	}
+	return nil
+}
+
+// typeString prints a type expression and records the imports it uses
+func (g *generator) typeString(f *ast.File, expr ast.Expr) (string, error) {
+	var err error
+	ast.Inspect(expr, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if pkg, ok := sel.X.(*ast.Ident); ok && err == nil {
+			err = g.addImport(f, pkg.Name)
+		}
+		return false
+	})
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, g.fset, expr); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// addImport finds the import of a package name in f
+func (g *generator) addImport(f *ast.File, name string) error {
+	if _, ok := g.imports[name]; ok {
+		return nil
+	}
+	for _, imp := range f.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		if imp.Name != nil && imp.Name.Name == name || imp.Name == nil && importName(path) == name {
+			g.imports[name] = path
+			return nil
+		}
+	}
+	return fmt.Errorf("import of %s not found", name)
+}
+
+// importName guesses the package name of an import path
+func importName(path string) string {
+	parts := strings.Split(path, "/")
+	name := parts[len(parts)-1]
+	if majorVersion.MatchString(name) && len(parts) > 1 {
+		name = parts[len(parts)-2]
+	}
+	if idx := strings.Index(name, ".v"); idx != -1 {
+		name = name[:idx]
+	}
+	name = strings.TrimPrefix(name, "go-")
+	return strings.ReplaceAll(name, "-", "")
+}
+
+func (g *generator) render() ([]byte, error) {
+	sort.Slice(g.methods, func(i, j int) bool {
+		if g.methods[i].recv != g.methods[j].recv {
+			return g.methods[i].recv < g.methods[j].recv
+		}
+		return g.methods[i].name < g.methods[j].name
+	})
+	imports := map[string]string{"reflect": "reflect", "restruct": "github.com/altlimit/restruct"}
+	for name, path := range g.imports {
+		imports[name] = path
+	}
+	var std, other []string
+	for name, path := range imports {
+		spec := strconv.Quote(path)
+		if parts := strings.Split(path, "/"); parts[len(parts)-1] != name {
+			spec = name + " " + spec
+		}
+		if strings.Contains(strings.Split(path, "/")[0], ".") {
+			other = append(other, spec)
+		} else {
+			std = append(std, spec)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by restructgen. DO NOT EDIT.\n\npackage %s\n\nimport (\n", g.pkg)
+	for _, spec := range std {
+		fmt.Fprintf(&b, "\t%s\n", spec)
+	}
+	b.WriteString("\n")
+	for _, spec := range other {
+		fmt.Fprintf(&b, "\t%s\n", spec)
+	}
+	b.WriteString(")\n\nfunc init() {\n")
+	for _, m := range g.methods {
+		recvs := []string{"*" + m.recv}
+		if !m.pointer {
+			recvs = append(recvs, m.recv)
+		}
+		for _, recv := range recvs {
+			g.renderMethod(&b, recv, m)
+		}
+	}
+	b.WriteString("}\n")
+	return format.Source(b.Bytes())
+}
+
+func (g *generator) renderMethod(b *bytes.Buffer, recv string, m methodInfo) {
+	fmt.Fprintf(b, "\trestruct.RegisterInvoker(%q, func(recv %s, args []reflect.Value) []reflect.Value {\n", m.name, recv)
+	args := make([]string, len(m.params))
+	for i, p := range m.params {
+		args[i] = fmt.Sprintf("a%d", i)
+		fmt.Fprintf(b, "\t\ta%d, _ := args[%d].Interface().(%s)\n", i, i, p)
+	}
+	call := fmt.Sprintf("recv.%s(%s)", m.name, strings.Join(args, ", "))
+	if m.results == 0 {
+		fmt.Fprintf(b, "\t\t%s\n\t\treturn nil\n\t})\n", call)
+		return
+	}
+	results := make([]string, m.results)
+	values := make([]string, m.results)
+	for i := range results {
+		results[i] = fmt.Sprintf("r%d", i)
+		values[i] = fmt.Sprintf("reflect.ValueOf(&r%d).Elem()", i)
+	}
+	fmt.Fprintf(b, "\t\t%s := %s\n", strings.Join(results, ", "), call)
+	fmt.Fprintf(b, "\t\treturn []reflect.Value{%s}\n\t})\n", strings.Join(values, ", "))
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSource = `package svc
+
+import (
+	"context"
+	"net/http"
+
+	rs "github.com/altlimit/restruct"
+)
+
+type User struct{}
+
+type Input struct{ Name string }
+
+func (u *User) Create(ctx context.Context, in Input) (*Input, error) { return &in, nil }
+func (u User) Hello(w http.ResponseWriter, r *http.Request)           {}
+func (u *User) Routes() []rs.Route                                    { return nil }
+func (u *User) Many(a ...int)                                         {}
+func (u *User) unexported()                                           {}
+
+type Other struct{}
+
+func (o *Other) Ping(w http.ResponseWriter) {}
+`
+
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "svc.go"), []byte(testSource), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	src, err := generate(dir, "restruct_invokers.go", []string{"User"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(src)
+	for _, want := range []string{
+		"// Code generated by restructgen. DO NOT EDIT.",
+		"package svc",
+		`"context"`,
+		`"net/http"`,
+		`"github.com/altlimit/restruct"`,
+		`restruct.RegisterInvoker("Create", func(recv *User, args []reflect.Value) []reflect.Value {`,
+		"a1, _ := args[1].Interface().(Input)",
+		"r0, r1 := recv.Create(a0, a1)",
+		`restruct.RegisterInvoker("Hello", func(recv User, args []reflect.Value) []reflect.Value {`,
+		`restruct.RegisterInvoker("Hello", func(recv *User, args []reflect.Value) []reflect.Value {`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %s in\n%s", want, out)
+		}
+	}
+	for _, skip := range []string{`"Routes"`, `"Many"`, `"unexported"`, `"Ping"`} {
+		if strings.Contains(out, skip) {
+			t.Errorf("unexpected %s in\n%s", skip, out)
+		}
+	}
+
+	src, err = generate(dir, "restruct_invokers.go", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(src), `restruct.RegisterInvoker("Ping", func(recv *Other`) {
+		t.Errorf("missing Other.Ping in\n%s", src)
+	}
+}
+
+func TestImportName(t *testing.T) {
+	for path, want := range map[string]string{
+		"net/http":                    "http",
+		"gopkg.in/yaml.v3":            "yaml",
+		"github.com/go-chi/chi/v5":    "chi",
+		"github.com/mattn/go-sqlite3": "sqlite3",
+	} {
+		if got := importName(path); got != want {
+			t.Errorf("importName(%s) got %s want %s", path, got, want)
+		}
+	}
+}
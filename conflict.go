@@ -0,0 +1,167 @@
+package restruct
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+type (
+	// RouteConflict describes routes that are ambiguous or can never match,
+	// Locations are the Go locations of the methods involved.
+	RouteConflict struct {
+		Path      string
+		Reason    string
+		Locations []string
+	}
+)
+
+func (rc RouteConflict) Error() string {
+	return "route " + rc.Path + ": " + rc.Reason + " (" + strings.Join(rc.Locations, ", ") + ")"
+}
+
+// routeShape returns the part used to compare routes, param names are
+// dropped so {id} and {userID} at the same position are the same route.
+func routeShape(part string) string {
+	_, constraint, wildcard, ok := parseParam(part)
+	if !ok {
+		if sp := parseSegment(part); sp != nil {
+			return sp.shape()
+		}
+		return part
+	}
+	if wildcard {
+		return "{*}"
+	}
+	return "{:" + constraint + "}"
+}
+
+// methodsOverlap reports whether two methods accept a common HTTP method,
+// no methods means all are accepted.
+func methodsOverlap(a, b *method) bool {
+	if a.methods == nil || b.methods == nil {
+		return true
+	}
+	for k := range a.methods {
+		if b.methods[k] {
+			return true
+		}
+	}
+	return false
+}
+
+// displayPath returns the path with its host if it has one
+func (m *method) displayPath() string {
+	if m.host == "" {
+		return m.path
+	}
+	return m.host + "/" + m.path
+}
+
+func (m *method) displayLocation() string {
+	if m.location == "" {
+		return "View"
+	}
+	return m.location
+}
+
+// findConflicts checks all routes for duplicates with overlapping methods,
+// different param names at the same position and parts after a wildcard.
+func findConflicts(methods []*method) (conflicts []RouteConflict) {
+	methods = append([]*method(nil), methods...)
+	sort.SliceStable(methods, func(i, j int) bool {
+		if methods[i].path != methods[j].path {
+			return methods[i].path < methods[j].path
+		}
+		return methods[i].location < methods[j].location
+	})
+
+	type named struct {
+		name string
+		m    *method
+	}
+	byShape := make(map[string][]*method)
+	var shapes []string
+	paramNames := make(map[string]named)
+	reported := make(map[string]bool)
+	for _, m := range methods {
+		// routes of different hosts never conflict
+		shape := []string{m.host}
+		for i, part := range m.pathParts {
+			shape = append(shape, routeShape(part))
+			name, _, wildcard, ok := parseParam(part)
+			if !ok {
+				continue
+			}
+			if wildcard && i < len(m.pathParts)-1 {
+				conflicts = append(conflicts, RouteConflict{
+					Path:      m.displayPath(),
+					Reason:    "parts after wildcard {" + name + "*} are unreachable",
+					Locations: []string{m.displayLocation()},
+				})
+			}
+			key := strings.Join(shape, "/")
+			prev, ok := paramNames[key]
+			if !ok {
+				paramNames[key] = named{name: name, m: m}
+				continue
+			}
+			if prev.name != name && !reported[key+"|"+name] {
+				reported[key+"|"+name] = true
+				conflicts = append(conflicts, RouteConflict{
+					Path:      m.displayPath(),
+					Reason:    "param {" + name + "} clashes with {" + prev.name + "} in " + prev.m.displayPath(),
+					Locations: []string{prev.m.displayLocation(), m.displayLocation()},
+				})
+			}
+			if wildcard {
+				break
+			}
+		}
+		key := strings.Join(shape, "/")
+		if _, ok := byShape[key]; !ok {
+			shapes = append(shapes, key)
+		}
+		byShape[key] = append(byShape[key], m)
+	}
+
+	for _, key := range shapes {
+		ms := byShape[key]
+		for i := 0; i < len(ms); i++ {
+			for j := i + 1; j < len(ms); j++ {
+				// routes with predicates or versions are told apart at request time
+				if !methodsOverlap(ms[i], ms[j]) || ms[i].matcher != nil || ms[j].matcher != nil ||
+					ms[i].version != ms[j].version {
+					continue
+				}
+				reason := "duplicate route, " + ms[j].path + " is shadowed by " + ms[i].path
+				if ms[i].path == ms[j].path {
+					reason = "duplicate route with overlapping methods"
+				}
+				conflicts = append(conflicts, RouteConflict{
+					Path:      ms[i].displayPath(),
+					Reason:    reason,
+					Locations: []string{ms[i].displayLocation(), ms[j].displayLocation()},
+				})
+			}
+		}
+	}
+	return
+}
+
+// Validate returns the route conflicts found when the routes were built,
+// see Strict to panic on these instead.
+func (h *Handler) Validate() error {
+	return h.routes().conflictsErr()
+}
+
+func (mc *methodCache) conflictsErr() error {
+	if len(mc.conflicts) == 0 {
+		return nil
+	}
+	errs := make([]error, len(mc.conflicts))
+	for i, c := range mc.conflicts {
+		errs[i] = c
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,181 @@
+package restruct
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+type (
+	// Constraint validates a single path segment for a {name:constraint} param.
+	Constraint func(string) bool
+
+	paramConstraint struct {
+		raw   string
+		match Constraint
+	}
+)
+
+var (
+	constraintsMu sync.RWMutex
+	constraints   = map[string]Constraint{
+		"int":   isInt,
+		"float": isFloat,
+		"alpha": isAlpha,
+		"alnum": isAlnum,
+		"uuid":  isUUID,
+	}
+	// compiled constraints by raw string, shared by the trie and view routes
+	constraintCache sync.Map
+)
+
+// RegisterConstraint adds a named constraint usable as {param:name} in paths.
+// Anything not registered is treated as a regular expression that must match
+// the whole segment. Register your constraints before creating handlers.
+func RegisterConstraint(name string, fn Constraint) {
+	constraintsMu.Lock()
+	defer constraintsMu.Unlock()
+	constraints[name] = fn
+}
+
+// parseParam splits a path part such as {name}, {name:constraint} or {name*}.
+// ok is false when the part is a static segment.
+func parseParam(part string) (name, constraint string, wildcard, ok bool) {
+	if len(part) <= 2 || part[0] != '{' || part[len(part)-1] != '}' {
+		return
+	}
+	// the first brace must close at the end, {name}.{ext} is a partial segment
+	depth := 0
+	for i := 0; i < len(part)-1; i++ {
+		switch part[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return
+			}
+		}
+	}
+	name = part[1 : len(part)-1]
+	ok = true
+	if len(part) > 3 && name[len(name)-1] == '*' {
+		name = name[:len(name)-1]
+		wildcard = true
+		return
+	}
+	if idx := strings.IndexByte(name, ':'); idx != -1 {
+		constraint = name[idx+1:]
+		name = name[:idx]
+	}
+	return
+}
+
+// getConstraint returns the compiled constraint, it panics on invalid regex
+// so mistakes are caught when the handler is built.
+func getConstraint(raw string) *paramConstraint {
+	if raw == "" {
+		return nil
+	}
+	if c, ok := constraintCache.Load(raw); ok {
+		return c.(*paramConstraint)
+	}
+	constraintsMu.RLock()
+	fn, ok := constraints[raw]
+	constraintsMu.RUnlock()
+	if !ok {
+		re, err := regexp.Compile("^(?:" + raw + ")$")
+		if err != nil {
+			panic("invalid path constraint " + raw + ": " + err.Error())
+		}
+		fn = re.MatchString
+	}
+	c := &paramConstraint{raw: raw, match: fn}
+	constraintCache.Store(raw, c)
+	return c
+}
+
+func isInt(s string) bool {
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		s = s[1:]
+	}
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isFloat(s string) bool {
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		s = s[1:]
+	}
+	digits := false
+	dot := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= '0' && c <= '9':
+			digits = true
+		case c == '.' && !dot:
+			dot = true
+		default:
+			return false
+		}
+	}
+	return digits
+}
+
+func isAlpha(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i] | 0x20
+		if c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlnum(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= '0' && c <= '9' {
+			continue
+		}
+		c |= 0x20
+		if c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !(c >= '0' && c <= '9' || c|0x20 >= 'a' && c|0x20 <= 'f') {
+				return false
+			}
+		}
+	}
+	return true
+}
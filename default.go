@@ -0,0 +1,106 @@
+package restruct
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+type (
+	// Defaulter is called by Bind after binding so a request struct can
+	// compute defaults for fields that are still empty or derived from others.
+	Defaulter interface {
+		SetDefaults()
+	}
+
+	fieldDefault struct {
+		index   int
+		value   []string // default values, slices split on commas
+		nested  bool
+		invalid string // why the default doesn't convert, it's skipped
+	}
+)
+
+// default plans by struct type
+var defaultsCache sync.Map
+
+// SetDefaults sets the zero fields of a struct and its nested structs with a
+// default:"20" tag, slices take comma separated values such as
+// default:"a,b". Field types are the same as BindQuery, defaults that don't
+// convert to the field type are skipped, with the DefaultReader they're
+// reported when the handler is built.
+func SetDefaults(out interface{}) {
+	v, ok := structValue(out)
+	if !ok {
+		return
+	}
+	setDefaults(v)
+}
+
+func setDefaults(v reflect.Value) {
+	for _, fd := range structDefaults(v.Type()) {
+		fv := v.Field(fd.index)
+		if fd.nested {
+			setDefaults(fv)
+			continue
+		}
+		if fd.invalid != "" || !fv.IsZero() {
+			continue
+		}
+		// parsed every time so pointers and slices aren't shared
+		val, ok, _ := parseValues(fd.value, fv.Type())
+		if ok {
+			fv.Set(val)
+		}
+	}
+}
+
+// structDefaults returns the cached defaults of a struct type
+func structDefaults(t reflect.Type) []fieldDefault {
+	if fds, ok := defaultsCache.Load(t); ok {
+		return fds.([]fieldDefault)
+	}
+	var fds []fieldDefault
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		def, ok := f.Tag.Lookup("default")
+		if !ok {
+			if isNested(f.Type) && len(structDefaults(f.Type)) > 0 {
+				fds = append(fds, fieldDefault{index: i, nested: true})
+			}
+			continue
+		}
+		fd := fieldDefault{index: i, value: []string{def}}
+		if f.Type.Kind() == reflect.Slice && f.Type.Elem().Kind() != reflect.Uint8 {
+			fd.value = strings.Split(def, ",")
+		}
+		if _, _, err := parseValues(fd.value, f.Type); err != nil {
+			fd.invalid = t.String() + "." + f.Name + ": " + def
+		}
+		fds = append(fds, fd)
+	}
+	defaultsCache.Store(t, fds)
+	return fds
+}
+
+// invalidDefaults returns the defaults of t and its nested structs that
+// don't convert such as Page.Size: abc.
+func invalidDefaults(t reflect.Type) (invalid []string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for _, fd := range structDefaults(t) {
+		if fd.nested {
+			invalid = append(invalid, invalidDefaults(t.Field(fd.index).Type)...)
+		} else if fd.invalid != "" {
+			invalid = append(invalid, fd.invalid)
+		}
+	}
+	return
+}
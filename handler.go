@@ -3,10 +3,14 @@ package restruct
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 type (
@@ -15,6 +19,10 @@ type (
 
 var (
 	ErrReaderReturnLen = errors.New("reader args len does not match")
+	ErrFrozen          = errors.New("restruct: handler is frozen")
+
+	defaultWriter ResponseWriter = &DefaultWriter{}
+	defaultReader RequestReader  = &DefaultReader{Bind: Bind}
 
 	// Pre-allocated error responses to avoid allocations in hot paths
 	errNotFoundTypes        = []reflect.Type{typeError}
@@ -28,10 +36,8 @@ func init() {
 }
 
 const (
-	keyParams ctxKey = "params"
-	keyVals   ctxKey = "vals"
-	keyIsAny  ctxKey = "isAny"
-	keyRoute  ctxKey = "route"
+	keyVals  ctxKey = "vals"
+	keyState ctxKey = "state"
 )
 
 type (
@@ -46,28 +52,59 @@ type (
 		Writer ResponseWriter
 		// Reader controls the input of your service, defaults to DefaultReader
 		Reader RequestReader
-
-		prefix            string
-		prefixLen         int
-		services          map[string]interface{}
-		cache             *methodCache
-		middlewares       []Middleware
-		writerInitialized bool
-		readerInitialized bool
+		// Strict panics when routes conflict, otherwise conflicts are logged
+		// and available with Validate
+		Strict bool
+		// VerbMethods maps methods starting with an HTTP verb to that verb only,
+		// GetUsers is GET /users and DeleteUsers_0 is DELETE /users/{0}.
+		// Set it in Init or before adding services as it's read when routes are built.
+		VerbMethods bool
+		// PathArgs binds scalar method args such as ReadUser(id int64) to the
+		// path params in order, without it they're read from the body array.
+		// Set it in Init or before adding services as it's read when routes are built.
+		PathArgs bool
+		// VersionHeader is the request header with the API version such as
+		// X-Api-Version: 2, the Accept header is used when it's not set or empty
+		VersionHeader string
+		// DefaultVersion is used when the request has no version, 0 is the newest
+		DefaultVersion int
+		// NameMapper converts method and field names to paths, defaults to
+		// KebabCase. A service can override it with the Namer interface.
+		NameMapper NameMapper
+
+		prefix      string
+		services    map[serviceKey]interface{}
+		middlewares []Middleware
+		// cache is an immutable routing snapshot swapped on every change,
+		// mu guards services, middlewares and rebuilding
+		cache  atomic.Pointer[methodCache]
+		mu     sync.Mutex
+		frozen bool
 	}
 
 	methodCache struct {
 		root        *node
+		hosts       []*hostRoutes // routes of services with a host, see AddServiceHost
 		paramRoutes []paramCache
 		byPath      map[string][]*method
+		byName      map[string][]*method
+		conflicts   []RouteConflict
+		options     http.Handler // automatic OPTIONS with global middlewares
+		middlewares int          // number of global middlewares
+		prefix      string       // handler prefix, see WithPrefix
+		prefixLen   int
 	}
 
 	node struct {
-		children      map[string]*node
-		paramChild    *node
-		paramName     string
+		children map[string]*node
+		// partial segment children such as {name}.{ext} are tried before
+		// param children, the ones with more static text first
+		patternChildren []*node
+		pattern         *segmentPattern
+		// param children are tried in order, constrained ones come first
+		paramChildren []*node
+		constraint    *paramConstraint
 		wildcardChild *node
-		wildcardName  string
 		methods       []*method
 	}
 
@@ -78,11 +115,13 @@ type (
 		isAny     bool
 	}
 
-	wrappedHandler struct {
-		handler http.Handler
+	// headResponseWriter discards the body when HEAD is served by GET
+	headResponseWriter struct {
+		http.ResponseWriter
 	}
 
 	viewInfo struct {
+		host   string
 		prefix string
 		view   *View
 	}
@@ -90,7 +129,7 @@ type (
 
 func (n *node) insert(parts []string, m *method) {
 	if len(parts) == 0 {
-		n.methods = append(n.methods, m)
+		n.methods = addMethod(n.methods, m)
 		return
 	}
 
@@ -102,25 +141,22 @@ func (n *node) insert(parts []string, m *method) {
 		return
 	}
 
-	if len(part) > 3 && part[0] == '{' && part[len(part)-1] == '}' && part[len(part)-2] == '*' {
+	_, constraint, wildcard, isParam := parseParam(part)
+	if wildcard {
 		// Wildcard node
 		if n.wildcardChild == nil {
 			n.wildcardChild = &node{
 				children: make(map[string]*node),
 			}
 		}
-		n.wildcardChild.wildcardName = part[1 : len(part)-2]
 		// Wildcards consume the rest, so we attach method here
-		n.wildcardChild.methods = append(n.wildcardChild.methods, m)
-	} else if len(part) > 2 && part[0] == '{' && part[len(part)-1] == '}' {
-		// Parameter node
-		if n.paramChild == nil {
-			n.paramChild = &node{
-				children: make(map[string]*node),
-			}
-		}
-		n.paramChild.paramName = part[1 : len(part)-1]
-		n.paramChild.insert(parts[1:], m)
+		n.wildcardChild.methods = addMethod(n.wildcardChild.methods, m)
+	} else if isParam {
+		// Parameter node, one per distinct constraint
+		n.paramChildFor(constraint).insert(parts[1:], m)
+	} else if sp := parseSegment(part); sp != nil {
+		// Partial segment node, one per distinct pattern
+		n.patternChildFor(sp).insert(parts[1:], m)
 	} else {
 		// Static node
 		if n.children == nil {
@@ -137,17 +173,73 @@ func (n *node) insert(parts []string, m *method) {
 	}
 }
 
-func (n *node) search(path string, params map[string]string) []*method {
+// paramChildFor returns the param child with the given constraint, creating it
+// if needed. Constrained children are kept before the unconstrained one so
+// they get the first chance to match.
+func (n *node) paramChildFor(constraint string) *node {
+	for _, child := range n.paramChildren {
+		if (child.constraint == nil && constraint == "") ||
+			(child.constraint != nil && child.constraint.raw == constraint) {
+			return child
+		}
+	}
+	child := &node{
+		children:   make(map[string]*node),
+		constraint: getConstraint(constraint),
+	}
+	if child.constraint == nil {
+		n.paramChildren = append(n.paramChildren, child)
+		return child
+	}
+	idx := len(n.paramChildren)
+	for i, c := range n.paramChildren {
+		if c.constraint == nil {
+			idx = i
+			break
+		}
+	}
+	n.paramChildren = append(n.paramChildren, nil)
+	copy(n.paramChildren[idx+1:], n.paramChildren[idx:])
+	n.paramChildren[idx] = child
+	return child
+}
+
+// patternChildFor returns the child of a partial segment pattern, creating
+// it if needed. Patterns with more static text are kept first.
+func (n *node) patternChildFor(sp *segmentPattern) *node {
+	for _, child := range n.patternChildren {
+		if child.pattern.raw == sp.raw {
+			return child
+		}
+	}
+	child := &node{
+		children: make(map[string]*node),
+		pattern:  sp,
+	}
+	idx := len(n.patternChildren)
+	for i, c := range n.patternChildren {
+		if c.pattern.static < sp.static {
+			idx = i
+			break
+		}
+	}
+	n.patternChildren = append(n.patternChildren, nil)
+	copy(n.patternChildren[idx+1:], n.patternChildren[idx:])
+	n.patternChildren[idx] = child
+	return child
+}
+
+func (n *node) search(path string) []*method {
 	// 1. Check if we match the current node and path is done
 	if path == "" {
 		return n.methods
 	}
 
 	// 2. Recursive search
-	return n.searchRecursive(path, params)
+	return n.searchRecursive(path)
 }
 
-func (n *node) searchRecursive(path string, params map[string]string) []*method {
+func (n *node) searchRecursive(path string) []*method {
 	idx := strings.Index(path, "/")
 	var part string
 	var remainder string
@@ -165,37 +257,53 @@ func (n *node) searchRecursive(path string, params map[string]string) []*method
 	// 1. Static Match
 	if n.children != nil {
 		if child, ok := n.children[part]; ok {
+			// a static node without methods must not shadow param routes
 			if isTerminal {
-				return child.methods
-			}
-			if res := child.searchRecursive(remainder, params); res != nil {
+				if child.methods != nil {
+					return child.methods
+				}
+			} else if res := child.searchRecursive(remainder); res != nil {
 				return res
 			}
 		}
 	}
 
-	// 2. Param Match
-	if n.paramChild != nil {
+	// 2. Partial segment match such as {name}.{ext}
+	for _, child := range n.patternChildren {
+		if isTerminal && child.methods == nil {
+			continue
+		}
+		if !child.pattern.match(part, nil) {
+			continue
+		}
+		res := child.methods
+		if !isTerminal {
+			res = child.searchRecursive(remainder)
+		}
+		if res != nil {
+			return res
+		}
+	}
+
+	// 3. Param Match, a failed constraint falls through to the next child
+	for _, child := range n.paramChildren {
+		if child.constraint != nil && !child.constraint.match(part) {
+			continue
+		}
 		if isTerminal {
-			if n.paramChild.paramName != "" {
-				params[n.paramChild.paramName] = part
+			if child.methods == nil {
+				continue
 			}
-			return n.paramChild.methods
+			return child.methods
 		}
 		// Recurse
-		if res := n.paramChild.searchRecursive(remainder, params); res != nil {
-			if n.paramChild.paramName != "" {
-				params[n.paramChild.paramName] = part
-			}
+		if res := child.searchRecursive(remainder); res != nil {
 			return res
 		}
 	}
 
-	// 3. Wildcard Match
+	// 4. Wildcard Match
 	if n.wildcardChild != nil {
-		if n.wildcardChild.wildcardName != "" {
-			params[n.wildcardChild.wildcardName] = path
-		}
 		return n.wildcardChild.methods
 	}
 
@@ -215,10 +323,18 @@ func (mc *methodCache) methods() (methods []*method) {
 		for _, child := range n.children {
 			traverse(child)
 		}
-		traverse(n.paramChild)
+		for _, child := range n.patternChildren {
+			traverse(child)
+		}
+		for _, child := range n.paramChildren {
+			traverse(child)
+		}
 		traverse(n.wildcardChild)
 	}
 	traverse(mc.root)
+	for _, hr := range mc.hosts {
+		traverse(hr.root)
+	}
 
 	for _, param := range mc.paramRoutes {
 		methods = append(methods, param.methods...)
@@ -229,19 +345,20 @@ func (mc *methodCache) methods() (methods []*method) {
 	return
 }
 
-func (wh *wrappedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	wh.handler.ServeHTTP(w, r)
+func (hw *headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
 }
 
 // discoverViews recursively walks a service's struct fields to find all
 // nested services that implement the Writer interface and return a *View.
-func discoverViews(prefix string, svc interface{}) []viewInfo {
+func discoverViews(host, prefix string, svc interface{}, nm naming) []viewInfo {
 	var views []viewInfo
+	nm = nm.forService(svc)
 
 	if v, ok := svc.(Writer); ok {
 		wr := v.Writer()
 		if vv, ok := wr.(*View); ok {
-			views = append(views, viewInfo{prefix: prefix, view: vv})
+			views = append(views, viewInfo{host: host, prefix: prefix, view: vv})
 		}
 	}
 
@@ -261,6 +378,9 @@ func discoverViews(prefix string, svc interface{}) []viewInfo {
 		if route == "-" {
 			continue
 		}
+		if _, ok := fieldHandler(vv.Field(i)); ok {
+			continue
+		}
 		fk := f.Type.Kind()
 		fv := vv.Field(i)
 		if fk == reflect.Ptr {
@@ -269,11 +389,16 @@ func discoverViews(prefix string, svc interface{}) []viewInfo {
 		}
 		if fk == reflect.Struct && fv.IsValid() {
 			if route == "" {
-				route = nameToPath(f.Name)
+				route = nm.path(f.Name)
 			}
-			route = strings.Trim(route, "/") + "/"
+			// route:"/" mounts the struct at the parent path, handy with host tags
+			route = servicePath(route)
 			sv := fv.Addr().Interface()
-			views = append(views, discoverViews(prefix+route, sv)...)
+			fieldHost := host
+			if th := f.Tag.Get("host"); th != "" {
+				fieldHost = normalizeHost(th)
+			}
+			views = append(views, discoverViews(fieldHost, prefix+route, sv, nm)...)
 		}
 	}
 
@@ -283,15 +408,72 @@ func discoverViews(prefix string, svc interface{}) []viewInfo {
 // NewHandler creates a handler for a given struct.
 func NewHandler(svc interface{}) *Handler {
 	h := &Handler{
-		services: map[string]interface{}{"": svc},
+		services: map[serviceKey]interface{}{{}: svc},
+		prefix:   "/",
 	}
-	h.mustCompile("")
 	if init, ok := svc.(Init); ok {
+		// configs such as Strict or VerbMethods may be changed in Init
 		init.Init(h)
 	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rebuild()
 	return h
 }
 
+// checkConflicts panics in strict mode or logs each route conflict.
+func (h *Handler) checkConflicts(mc *methodCache) {
+	if len(mc.conflicts) == 0 {
+		return
+	}
+	if h.Strict {
+		panic(mc.conflictsErr())
+	}
+	for _, c := range mc.conflicts {
+		slog.Warn("route conflict", "path", c.Path, "reason", c.Reason, "locations", c.Locations)
+	}
+}
+
+// checkRules reports validate rules that aren't registered for the structs
+// read by the DefaultReader, it panics in strict mode or logs them.
+func (h *Handler) checkRules(m *method) {
+	dr, ok := h.reader().(*DefaultReader)
+	if !ok || dr.SkipValidation {
+		return
+	}
+	seen := make(map[reflect.Type]bool)
+	var unknown []string
+	for _, t := range m.readerTypes {
+		unknown = append(unknown, unknownRules(t, seen)...)
+	}
+	if len(unknown) == 0 {
+		return
+	}
+	if h.Strict {
+		panic("unknown validate rules " + strings.Join(unknown, ", ") + " in " + m.location)
+	}
+	slog.Warn("unknown validate rules", "rules", unknown, "location", m.location)
+}
+
+// checkDefaults reports default tags that don't convert for the structs
+// read by the DefaultReader, it panics in strict mode or logs them.
+func (h *Handler) checkDefaults(m *method) {
+	if _, ok := h.reader().(*DefaultReader); !ok {
+		return
+	}
+	var invalid []string
+	for _, t := range m.readerTypes {
+		invalid = append(invalid, invalidDefaults(t)...)
+	}
+	if len(invalid) == 0 {
+		return
+	}
+	if h.Strict {
+		panic("invalid defaults " + strings.Join(invalid, ", ") + " in " + m.location)
+	}
+	slog.Warn("invalid defaults", "defaults", invalid, "location", m.location)
+}
+
 // WithPrefix prefixes your service with given path. You can't use parameters here.
 // This is useful if you want to register this handler with another third party router.
 func (h *Handler) WithPrefix(prefix string) *Handler {
@@ -299,158 +481,300 @@ func (h *Handler) WithPrefix(prefix string) *Handler {
 	return h
 }
 
+// Freeze builds the routes and locks the handler, any later AddService,
+// RemoveService, Use or WithPrefix panics with ErrFrozen. Use it once setup
+// is done to catch changes made after the server has started.
+func (h *Handler) Freeze() *Handler {
+	h.routes()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.frozen = true
+	return h
+}
+
 // Routes returns a list of routes registered and it's definition
 func (h *Handler) Routes() (routes []string) {
-	h.updateCache()
-	for _, m := range h.cache.methods() {
-		var methods []string
-		for k := range m.methods {
-			methods = append(methods, k)
-		}
-		if len(methods) == 0 {
-			methods = append(methods, "*")
-		}
-		r := h.prefix + m.path + " [" + strings.Join(methods, ",") + "] -> " + m.location
-		var params []string
-		for _, v := range m.params {
-			params = append(params, v.String())
-		}
-		var returns []string
-		for _, v := range m.returns {
-			returns = append(returns, v.String())
-		}
-		r += "(" + strings.Join(params, ", ") + ")"
-		if len(returns) > 0 {
-			r += " (" + strings.Join(returns, ", ") + ")"
-		}
-		routes = append(routes, r)
+	for _, ri := range h.RouteInfos() {
+		routes = append(routes, ri.String())
 	}
-	sort.Strings(routes)
 	return
 }
 
+// URL returns the path of a named route with params filled in, name is
+// Type.Method such as "User.ReadUser" or the full location shown in Routes().
+// When a method has several routes the first one whose params are all
+// given is used, it returns an error if none can be built.
+func (h *Handler) URL(name string, params map[string]string) (string, error) {
+	mc := h.routes()
+	ms, ok := mc.byName[name]
+	if !ok {
+		return "", fmt.Errorf("restruct: route %s not found", name)
+	}
+	var err error
+	for _, m := range ms {
+		var p string
+		if p, err = m.buildPath(params); err == nil {
+			return mc.prefix + p, nil
+		}
+	}
+	return "", fmt.Errorf("restruct: route %s %w", name, err)
+}
+
 // AddService adds a new service to specified route.
-// You can put {param} in this route.
+// You can put {param} in this route. It's safe to call while serving,
+// requests use the previous routes until the new ones are built.
 func (h *Handler) AddService(path string, svc interface{}) {
-	path = strings.TrimPrefix(path, "/")
-	if path != "" && !strings.HasSuffix(path, "/") {
-		path += "/"
+	key := serviceKey{path: servicePath(path)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.mustNotFreeze()
+	if _, ok := h.services[key]; ok {
+		panic("service " + key.path + " already exists")
 	}
-	if _, ok := h.services[path]; ok {
-		panic("service " + path + " already exists")
+	// rebuild now so conflicts are reported where the service is added
+	h.addService(key, svc)
+}
+
+// addService adds the service and rebuilds, h.mu must be held. The service
+// is removed if the rebuild panics so a recovered strict mode conflict
+// doesn't break later changes.
+func (h *Handler) addService(key serviceKey, svc interface{}) {
+	h.services[key] = svc
+	defer func() {
+		if r := recover(); r != nil {
+			delete(h.services, key)
+			panic(r)
+		}
+	}()
+	h.rebuild()
+}
+
+// RemoveService removes the service at the specified route, it returns false
+// if there's no service there. It's safe to call while serving.
+func (h *Handler) RemoveService(path string) bool {
+	key := serviceKey{path: servicePath(path)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.mustNotFreeze()
+	if _, ok := h.services[key]; !ok {
+		return false
 	}
-	h.services[path] = svc
-	h.cache = nil
+	delete(h.services, key)
+	h.rebuild()
+	return true
 }
 
 // Use adds a middleware to your services.
 func (h *Handler) Use(fns ...Middleware) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.mustNotFreeze()
 	h.middlewares = append(h.middlewares, fns...)
+	if h.cache.Load() != nil {
+		h.rebuild()
+	}
 }
 
-// ServeHTTP calls the method with the matched route.
-func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	path := r.URL.Path[h.prefixLen:]
-	// Lazy initialization with flags to avoid nil checks on every request
-	if !h.writerInitialized {
-		if h.Writer == nil {
-			h.Writer = &DefaultWriter{}
-		}
-		h.writerInitialized = true
+func (h *Handler) mustNotFreeze() {
+	if h.frozen {
+		panic(ErrFrozen)
 	}
-	if !h.readerInitialized {
-		if h.Reader == nil {
-			h.Reader = &DefaultReader{Bind: Bind}
-		}
-		h.readerInitialized = true
+}
+
+func servicePath(path string) string {
+	path = strings.TrimPrefix(path, "/")
+	if path != "" && !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	return path
+}
+
+// routes returns the current routing snapshot, building it if needed.
+func (h *Handler) routes() *methodCache {
+	if mc := h.cache.Load(); mc != nil {
+		return mc
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if mc := h.cache.Load(); mc != nil {
+		return mc
 	}
-	// if there are middleware we wrap it in reverse so it's called
-	// in the order they were added
-	chain := func(m *method) *wrappedHandler {
-		handler := &wrappedHandler{handler: h.createHandler(m)}
-		middlewares := append(h.middlewares, m.middlewares...)
+	return h.rebuild()
+}
+
+// rebuild builds a new routing snapshot and swaps it in, h.mu must be held.
+func (h *Handler) rebuild() *methodCache {
+	mc := h.buildCache()
+	h.cache.Store(mc)
+	return mc
+}
+
+// buildChains wraps every method with the global and its own middlewares
+// once, so middleware constructors are not called per request. Middlewares
+// are wrapped in reverse so they're called in the order they were added.
+func (h *Handler) buildChains(mc *methodCache) {
+	wrap := func(handler http.Handler, middlewares ...[]Middleware) http.Handler {
 		for i := len(middlewares) - 1; i >= 0; i-- {
-			handler = &wrappedHandler{handler: middlewares[i](handler)}
+			for j := len(middlewares[i]) - 1; j >= 0; j-- {
+				handler = middlewares[i][j](handler)
+			}
 		}
 		return handler
 	}
-	runMethod := func(m *method) {
-		chain(m).ServeHTTP(w, r)
+	for _, m := range mc.methods() {
+		m.handler = wrap(h.createHandler(m), h.middlewares, m.middlewares)
 	}
+	mc.middlewares = len(h.middlewares)
+	mc.options = wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}), h.middlewares)
+}
+
+// ServeHTTP calls the method with the matched route.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	mc := h.routes()
+	path := r.URL.Path[mc.prefixLen:]
 	// we check path look up first then see if proper method
-	if vals, ok := h.cache.byPath[path]; ok {
-		for _, m := range vals {
-			ok := m.methods == nil
-			if !ok {
-				_, ok = m.methods[r.Method]
-			}
-			if ok {
-				runMethod(m)
-				return
-			}
+	if vals, ok := mc.byPath[path]; ok {
+		vals, status := h.candidates(vals, r)
+		if m, head := matchMethod(vals, r.Method); m != nil {
+			h.serveMethod(w, r, m, path, nil, head)
+			return
 		}
-		h.Writer.Write(w, r, errNotFoundTypes, errMethodNotAllowedVals)
+		h.noMethod(w, r, mc, vals, status)
 		return
 	}
-	// we do heavier look up such as path parts or regex then if any match
-	// we set path found but still need to match method for proper error return
-	status := http.StatusNotFound
 
 	// Try Trie search (now handles static, param, and wildcard routes)
-	if h.cache.root != nil {
-		params := make(map[string]string)
-		methods := h.cache.root.search(path, params)
+	if mc.root != nil || len(mc.hosts) > 0 {
+		methods, hostParams := mc.search(r.Host, path)
 		if methods != nil {
-
-			for _, v := range methods {
-				ok := v.methods == nil
-				if !ok {
-					_, ok = v.methods[r.Method]
-				}
-				if ok {
-					// Apply params
-					if len(params) > 0 {
-						// Re-extract params using the method's own pathParts
-						if v.pathParts != nil {
-							correctParams := extractParamsFromPath(path, v.pathParts)
-							if len(correctParams) > 0 {
-								params = correctParams
-							}
-						}
-
-						ctx := r.Context()
-						ctx = context.WithValue(ctx, keyParams, params)
-						// If wildcard param exists, flag it?
-						// We used to set keyIsAny=true.
-						// We can check if any param ends in "*" or is "any"?
-						// The tests might check for "any" param specifically.
-
-						// Legacy support: if we have "any" param, treat as catch-all
-						if _, hasAny := params["any"]; hasAny {
-							ctx = context.WithValue(ctx, keyIsAny, true)
-						}
-
-						ctx = context.WithValue(ctx, keyRoute, v.path)
-						r = r.WithContext(ctx)
-					} else {
-						ctx := r.Context()
-						ctx = context.WithValue(ctx, keyRoute, v.path)
-						r = r.WithContext(ctx)
-					}
-					runMethod(v)
-					return
-				}
+			methods, status := h.candidates(methods, r)
+			v, head := matchMethod(methods, r.Method)
+			if v == nil {
+				h.noMethod(w, r, mc, methods, status)
+				return
 			}
-			status = http.StatusMethodNotAllowed
+			h.serveMethod(w, r, v, path, hostParams, head)
+			return
 		}
 	}
 
 	// Use pre-allocated error values for common cases
-	if status == http.StatusNotFound {
-		h.Writer.Write(w, r, errNotFoundTypes, errNotFoundVals)
-	} else {
-		h.Writer.Write(w, r, errNotFoundTypes, errMethodNotAllowedVals)
+	h.writer().Write(w, r, errNotFoundTypes, errNotFoundVals)
+}
+
+// serveMethod runs the method chain with the routing state of path in the
+// request context, head is true when a HEAD request is served by GET.
+// Params are read with the method's own path parts since methods sharing a
+// trie node can name their params differently, host params don't override
+// path params with the same name.
+func (h *Handler) serveMethod(w http.ResponseWriter, r *http.Request, m *method, path string, hostParams map[string]string, head bool) {
+	st := newRequestState()
+	st.params = appendParams(st.params, path, m.pathParts)
+	for k, v := range hostParams {
+		st.addParam(k, v)
+	}
+	// Legacy support: if we have "any" param, treat as catch-all
+	_, st.isAny = st.param("any")
+	st.route = m.route
+	st.version = m.version
+	r = r.WithContext(context.WithValue(r.Context(), keyState, st))
+	if head {
+		// HEAD is served by the GET method with the body discarded
+		w = &headResponseWriter{ResponseWriter: w}
+	}
+	m.handler.ServeHTTP(w, r)
+}
+
+// candidates filters methods by their predicates and version, status is
+// set when none are left, see matchRoutes.
+func (h *Handler) candidates(ms []*method, r *http.Request) ([]*method, int) {
+	ms, status := matchRoutes(ms, r)
+	ms = h.matchVersion(ms, r)
+	if len(ms) == 0 && status == 0 {
+		status = http.StatusNotFound
+	}
+	return ms, status
+}
+
+// noMethod writes the status from matchRoutes if set, otherwise the path
+// matched with another HTTP method.
+func (h *Handler) noMethod(w http.ResponseWriter, r *http.Request, mc *methodCache, ms []*method, status int) {
+	switch status {
+	case 0:
+		h.methodNotAllowed(w, r, mc, ms)
+	case http.StatusNotFound:
+		h.writer().Write(w, r, errNotFoundTypes, errNotFoundVals)
+	default:
+		h.writer().Write(w, r, errNotFoundTypes, refVals(Error{Status: status}))
+	}
+}
+
+// methodNotAllowed sets the Allow header for a matched path, it answers
+// OPTIONS through the global middlewares (e.g. for CORS) or writes a 405.
+func (h *Handler) methodNotAllowed(w http.ResponseWriter, r *http.Request, mc *methodCache, ms []*method) {
+	w.Header().Set("Allow", allowedMethods(ms))
+	if r.Method == http.MethodOptions {
+		mc.options.ServeHTTP(w, r)
+		return
+	}
+	h.writer().Write(w, r, errNotFoundTypes, errMethodNotAllowedVals)
+}
+
+// writer returns the Writer or DefaultWriter if not set, without mutating
+// the handler so it's safe while serving.
+func (h *Handler) writer() ResponseWriter {
+	if h.Writer != nil {
+		return h.Writer
 	}
+	return defaultWriter
+}
+
+// reader returns the Reader or DefaultReader if not set.
+func (h *Handler) reader() RequestReader {
+	if h.Reader != nil {
+		return h.Reader
+	}
+	return defaultReader
+}
+
+// matchMethod returns the first method that accepts the request method,
+// head is true when a HEAD request falls back to a GET method.
+func matchMethod(ms []*method, reqMethod string) (m *method, head bool) {
+	for _, v := range ms {
+		if v.methods == nil || v.methods[reqMethod] {
+			return v, false
+		}
+	}
+	if reqMethod == http.MethodHead {
+		for _, v := range ms {
+			if v.methods[http.MethodGet] {
+				return v, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// allowedMethods returns the value for the Allow header, HEAD is implied
+// by GET and OPTIONS is always answered.
+func allowedMethods(ms []*method) string {
+	seen := map[string]bool{http.MethodOptions: true}
+	for _, m := range ms {
+		for k := range m.methods {
+			seen[k] = true
+		}
+	}
+	if seen[http.MethodGet] {
+		seen[http.MethodHead] = true
+	}
+	allow := make([]string, 0, len(seen))
+	for k := range seen {
+		allow = append(allow, k)
+	}
+	sort.Strings(allow)
+	return strings.Join(allow, ", ")
 }
 
 // wrapped handler that calls the actual method and processes the returns
@@ -458,6 +782,8 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // the returns can be anything or an error which will be sent to the ResponseWriter
 // a multiple return is passed as slice of interface{}
 func (h *Handler) createHandler(m *method) http.Handler {
+	h.checkRules(m)
+	h.checkDefaults(m)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		args := make([]reflect.Value, len(m.params))
 		for k, v := range m.params {
@@ -470,27 +796,49 @@ func (h *Handler) createHandler(m *method) http.Handler {
 				args[k] = reflect.ValueOf(r.Context())
 			}
 		}
+		// scalar params bound to path params in order (pre-computed at init)
+		if len(m.pathIndexes) > 0 {
+			ctx := r.Context()
+			for k, i := range m.pathIndexes {
+				name := m.pathNames[k]
+				val, err := parseScalar(pathParam(ctx, name), m.params[i])
+				if err != nil {
+					h.writer().Write(w, r, refTypes(typeError), refVals(Error{
+						Status:  http.StatusBadRequest,
+						Message: "invalid path param " + name,
+						Err:     err,
+					}))
+					return
+				}
+				args[i] = val
+			}
+		}
 		// has unknown types in parameters, use RequestReader (pre-computed at init)
 		if len(m.readerIndexes) > 0 {
-			typeArgs, err := h.Reader.Read(r, m.readerTypes)
+			typeArgs, err := h.reader().Read(r, m.readerTypes)
 			if err != nil {
-				h.Writer.Write(w, r, refTypes(typeError), refVals(err))
+				h.writer().Write(w, r, refTypes(typeError), refVals(err))
 				return
 			}
 			if len(typeArgs) != len(m.readerIndexes) {
-				h.Writer.Write(w, r, refTypes(typeError), refVals(Error{Err: ErrReaderReturnLen}))
+				h.writer().Write(w, r, refTypes(typeError), refVals(Error{Err: ErrReaderReturnLen}))
 				return
 			}
 			for k, i := range m.readerIndexes {
 				args[i] = typeArgs[k]
 			}
 		}
-		out := m.source.Call(args)
+		var out []reflect.Value
+		if m.invoke != nil {
+			out = m.invoke(args)
+		} else {
+			out = m.source.Call(args)
+		}
 		ot := len(out)
 		if ot == 0 {
 			return
 		}
-		writer := h.Writer
+		writer := h.writer()
 		if m.writer != nil {
 			writer = m.writer
 		}
@@ -498,35 +846,38 @@ func (h *Handler) createHandler(m *method) http.Handler {
 	})
 }
 
-// Called every time you add a handler to create a cached info about
+// Called every time you add a handler to create a new cached info about
 // your routes and which methods it points to. This will also look up
 // exported structs to add as a service. You can avoid this by adding
 // route:"-" or to specify specific route add route:"path/{hello}"
-func (h *Handler) updateCache() {
-	if h.cache != nil {
-		return
-	}
+func (h *Handler) buildCache() *methodCache {
 	if h.prefix == "" {
-		h.mustCompile("")
+		h.prefix = "/"
 	}
-	h.cache = &methodCache{
-		byPath: make(map[string][]*method),
+	mc := &methodCache{
+		byPath:    make(map[string][]*method),
+		prefix:    h.prefix,
+		prefixLen: len(h.prefix),
 	}
 	// cache all same paths so we only compare it once
 	pathCache := make(map[string][]*method)
 	// we store ordered paths so it's still looked up in order you enter it
 	var orderedPaths []string
+	nm := naming{verbs: h.VerbMethods, mapper: h.NameMapper}
 	for k, svc := range h.services {
 		// Discover all views including from nested structs
-		allViews := discoverViews(k, svc)
+		allViews := discoverViews(k.host, k.path, svc, nm)
 		for _, vi := range allViews {
 			if vi.view.Writer == nil {
 				vi.view.Writer = h.Writer
 			}
 			vi.view.prefix = vi.prefix
+			vi.view.handler = h
 		}
 
-		for _, v := range serviceToMethods(k, svc) {
+		svcMethods := serviceToMethods(k.path, svc, nm)
+		setHost(svcMethods, k.host)
+		for _, v := range svcMethods {
 
 			if v.Name == "Any" || strings.HasSuffix(v.Name, "_Any") {
 				basePath := v.path
@@ -544,15 +895,19 @@ func (h *Handler) updateCache() {
 					v.pathParts = []string{"{any*}"}
 				}
 			}
+			if h.PathArgs {
+				v.bindPathArgs()
+			}
 
 			if v.pathParts != nil {
-				_, ok := pathCache[v.path]
+				key := routeKey(v.host, v.path)
+				_, ok := pathCache[key]
 				if !ok {
-					orderedPaths = append(orderedPaths, v.path)
+					orderedPaths = append(orderedPaths, key)
 				}
-				pathCache[v.path] = append(pathCache[v.path], v)
+				pathCache[key] = append(pathCache[key], v)
 			} else {
-				h.cache.byPath[v.path] = append(h.cache.byPath[v.path], v)
+				mc.byPath[v.path] = append(mc.byPath[v.path], v)
 			}
 		}
 
@@ -578,19 +933,21 @@ func (h *Handler) updateCache() {
 					fullPath = strings.TrimRight(vi.prefix, "/") + "/" + r
 				}
 
-				_, existingInCache := pathCache[fullPath]
-				_, existingInByPath := h.cache.byPath[fullPath]
+				key := routeKey(vi.host, fullPath)
+				_, existingInCache := pathCache[key]
+				_, existingInByPath := mc.byPath[fullPath]
 				if !existingInCache && !existingInByPath {
-					orderedPaths = append(orderedPaths, fullPath)
+					orderedPaths = append(orderedPaths, key)
 					m := &method{
-						source:  viewMethod.source,
-						path:    fullPath,
-						params:  viewMethod.params,
-						returns: viewMethod.returns,
-						writer:  svcView,
+						source: viewMethod.source,
+						path:   fullPath,
+						host:   vi.host,
+						writer: svcView,
+						view:   true,
 					}
 					m.mustParse()
-					pathCache[fullPath] = []*method{m}
+					m.setRoute(Route{})
+					pathCache[key] = []*method{m}
 				}
 			}
 		}
@@ -600,24 +957,40 @@ func (h *Handler) updateCache() {
 		m := pathCache[path][0]
 
 		if m.pathParts != nil {
-			// Add to Trie
-			if h.cache.root == nil {
-				h.cache.root = &node{
-					children: make(map[string]*node),
-				}
-			}
+			// Add to Trie, services with a host have their own
 			for _, method := range pathCache[path] {
-				h.cache.root.insert(method.pathParts, method)
+				mc.hostRoot(method.host).insert(method.pathParts, method)
 			}
 		} else {
-			h.cache.byPath[path] = pathCache[path]
+			mc.byPath[m.path] = pathCache[path]
+		}
+	}
+	mc.sortHosts()
+
+	// index routes by name for URL, routes using more params are tried first
+	mc.byName = make(map[string][]*method)
+	for _, m := range mc.methods() {
+		for _, name := range m.names() {
+			mc.byName[name] = append(mc.byName[name], m)
 		}
 	}
+	for _, ms := range mc.byName {
+		sort.Slice(ms, func(i, j int) bool {
+			if len(ms[i].pathParts) != len(ms[j].pathParts) {
+				return len(ms[i].pathParts) > len(ms[j].pathParts)
+			}
+			return ms[i].path < ms[j].path
+		})
+	}
+
+	mc.conflicts = findConflicts(mc.methods())
+	h.checkConflicts(mc)
+	h.buildChains(mc)
 
 	// Sort paramRoutes once at cache build time for optimal lookup order
-	sort.Slice(h.cache.paramRoutes, func(i, j int) bool {
-		p1 := h.cache.paramRoutes[i]
-		p2 := h.cache.paramRoutes[j]
+	sort.Slice(mc.paramRoutes, func(i, j int) bool {
+		p1 := mc.paramRoutes[i]
+		p2 := mc.paramRoutes[j]
 
 		// Prefer longer base path (more specific)
 		l1 := len(p1.path)
@@ -633,50 +1006,18 @@ func (h *Handler) updateCache() {
 
 		return p1.path > p2.path // determinism
 	})
+	return mc
 }
 
 func (h *Handler) mustCompile(prefix string) {
 	if !strings.HasSuffix(prefix, "/") {
 		prefix += "/"
 	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.mustNotFreeze()
 	h.prefix = prefix
-	h.prefixLen = len(h.prefix)
-	h.updateCache()
-}
-
-// extractParamsFromPath extracts route params from a URL path using the given pathParts.
-// This is used to re-extract params with correct names after Trie lookup.
-func extractParamsFromPath(urlPath string, pathParts []string) map[string]string {
-	params := make(map[string]string)
-	for _, part := range pathParts {
-		if urlPath == "" {
-			break
-		}
-		idx := strings.Index(urlPath, "/")
-		var segment string
-		if idx == -1 {
-			segment = urlPath
-			urlPath = ""
-		} else {
-			segment = urlPath[:idx]
-			urlPath = urlPath[idx+1:]
-		}
-
-		if len(part) > 2 && part[0] == '{' && part[len(part)-1] == '}' {
-			name := part[1 : len(part)-1]
-			// Handle wildcards
-			if len(name) > 0 && name[len(name)-1] == '*' {
-				name = name[:len(name)-1]
-				params[name] = segment
-				if urlPath != "" {
-					params[name] += "/" + urlPath
-				}
-				break
-			}
-			params[name] = segment
-		}
-	}
-	return params
+	h.rebuild()
 }
 
 // Checks path against request path if it's valid, this accepts a stripped path and not a full path
@@ -701,11 +1042,8 @@ func matchPath(pc paramCache, path string) (params map[string]string, ok bool) {
 
 		mPart := pc.pathParts[idx]
 
-		if mPart[0] == '{' {
-			name := mPart[1 : len(mPart)-1]
-			isWild := len(name) > 0 && name[len(name)-1] == '*'
+		if name, constraint, isWild, isParam := parseParam(mPart); isParam {
 			if isWild {
-				name = name[:len(name)-1]
 				params[name] = path
 				ok = true
 				return
@@ -728,6 +1066,9 @@ func matchPath(pc paramCache, path string) (params map[string]string, ok bool) {
 			if part == "" {
 				return
 			}
+			if c := getConstraint(constraint); c != nil && !c.match(part) {
+				return
+			}
 
 			params[name] = part
 		} else {
@@ -741,7 +1082,11 @@ func matchPath(pc paramCache, path string) (params map[string]string, ok bool) {
 				path = path[i+1:]
 			}
 
-			if mPart != part {
+			if sp := parseSegment(mPart); sp != nil {
+				if !sp.match(part, params) {
+					return
+				}
+			} else if mPart != part {
 				// Failed match
 				return
 			}
@@ -3,12 +3,15 @@ package restruct_test
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"testing/fstest"
 
@@ -326,3 +329,1351 @@ func TestNestedStructViewRoutes(t *testing.T) {
 		}
 	}
 }
+
+type constraintService struct{}
+
+func (c *constraintService) Routes() []rs.Route {
+	return []rs.Route{
+		{Handler: "ByID", Path: "items/{id:int}"},
+		{Handler: "ByUUID", Path: "items/{uuid:uuid}"},
+		{Handler: "BySlug", Path: "items/{slug:[a-z-]+}"},
+		{Handler: "ByName", Path: "items/{name}/info"},
+	}
+}
+
+func (c *constraintService) ByID(ctx context.Context) string {
+	return "id:" + rs.Vars(ctx)["id"]
+}
+
+func (c *constraintService) ByUUID(ctx context.Context) string {
+	return "uuid:" + rs.Vars(ctx)["uuid"]
+}
+
+func (c *constraintService) BySlug(ctx context.Context) string {
+	return "slug:" + rs.Vars(ctx)["slug"]
+}
+
+func (c *constraintService) ByName(ctx context.Context) string {
+	return "name:" + rs.Vars(ctx)["name"]
+}
+
+func TestRouteConstraints(t *testing.T) {
+	h := rs.NewHandler(&constraintService{})
+
+	routes := strings.Join(h.Routes(), "\n")
+	for _, want := range []string{"/items/{id:int} [*]", "/items/{uuid:uuid} [*]", "/items/{slug:[a-z-]+} [*]"} {
+		if !strings.Contains(routes, want) {
+			t.Errorf("routes missing %s in \n%s", want, routes)
+		}
+	}
+
+	tests := []struct {
+		path       string
+		wantBody   string
+		wantStatus int
+	}{
+		{"/items/42", `"id:42"`, 200},
+		{"/items/0b8e6a4c-1f3a-4d7e-9c2b-5a6f7e8d9c0b", `"uuid:0b8e6a4c-1f3a-4d7e-9c2b-5a6f7e8d9c0b"`, 200},
+		{"/items/hello-world", `"slug:hello-world"`, 200},
+		{"/items/Hello", `{"error":"Not Found"}`, 404},
+		{"/items/Hello/info", `"name:Hello"`, 200},
+		{"/items/42/info", `"name:42"`, 200},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		res := w.Result()
+		data, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		body := strings.TrimRight(string(data), "\n")
+
+		if res.StatusCode != tc.wantStatus {
+			t.Errorf("path %s: want status %d, got %d", tc.path, tc.wantStatus, res.StatusCode)
+		}
+		if body != tc.wantBody {
+			t.Errorf("path %s: want body %q, got %q", tc.path, tc.wantBody, body)
+		}
+	}
+}
+
+type pathArgService struct{}
+
+func (p *pathArgService) Init(h *rs.Handler) {
+	h.PathArgs = true
+}
+
+type postRequest struct {
+	UserID string `path:"uid"`
+	PostID int64  `path:"pid"`
+	Title  string `json:"title"`
+}
+
+func (p *pathArgService) Routes() []rs.Route {
+	return []rs.Route{
+		{Handler: "Post", Path: "users/{uid}/posts/{pid}", Methods: []string{http.MethodPut}},
+		{Handler: "PostReq", Path: "users/{uid}/post-req/{pid}", Methods: []string{http.MethodPut}},
+	}
+}
+
+func (p *pathArgService) Item_0(id int64) int64 {
+	return id * 2
+}
+
+func (p *pathArgService) Post(uid string, pid int, body struct {
+	Title string `json:"title"`
+}) string {
+	return fmt.Sprintf("%s/%d/%s", uid, pid, body.Title)
+}
+
+func (p *pathArgService) PostReq(req postRequest) string {
+	return fmt.Sprintf("%s/%d/%s", req.UserID, req.PostID, req.Title)
+}
+
+func TestPathArgs(t *testing.T) {
+	h := rs.NewHandler(&pathArgService{})
+	jh := map[string]string{"Content-Type": "application/json"}
+
+	tests := []struct {
+		method     string
+		path       string
+		body       string
+		headers    map[string]string
+		wantBody   string
+		wantStatus int
+	}{
+		{http.MethodGet, "/item/21", ``, nil, `42`, 200},
+		{http.MethodGet, "/item/abc", ``, nil, `{"error":"invalid path param 0"}`, 400},
+		{http.MethodPut, "/users/u1/posts/7", `{"title":"hi"}`, jh, `"u1/7/hi"`, 200},
+		{http.MethodPut, "/users/u1/posts/x", `{"title":"hi"}`, jh, `{"error":"invalid path param pid"}`, 400},
+		{http.MethodPut, "/users/u2/post-req/9", `{"title":"yo"}`, jh, `"u2/9/yo"`, 200},
+		{http.MethodPut, "/users/u2/post-req/y", `{"title":"yo"}`, jh, `{"error":"invalid path param pid"}`, 400},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		for k, v := range tc.headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		res := w.Result()
+		data, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		body := strings.TrimRight(string(data), "\n")
+
+		if res.StatusCode != tc.wantStatus {
+			t.Errorf("path %s: want status %d, got %d", tc.path, tc.wantStatus, res.StatusCode)
+		}
+		if body != tc.wantBody {
+			t.Errorf("path %s: want body %q, got %q", tc.path, tc.wantBody, body)
+		}
+	}
+}
+
+type bodyArgService struct{}
+
+func (bodyArgService) Update_0(ctx context.Context, name string, n int) string {
+	return fmt.Sprintf("%s %s %d", rs.Vars(ctx)["0"], name, n)
+}
+
+func TestBodyArgs(t *testing.T) {
+	// without PathArgs scalars are still read from the body array
+	h := rs.NewHandler(&bodyArgService{})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/update/5", strings.NewReader(`["bob", 3]`)))
+	if body := strings.TrimRight(w.Body.String(), "\n"); w.Code != 200 || body != `"5 bob 3"` {
+		t.Errorf("want body args got %d %s", w.Code, body)
+	}
+}
+
+type urlService struct {
+	Pages urlPages
+}
+
+type urlPages struct {
+	viewFS fstest.MapFS
+}
+
+func (p *urlPages) Writer() rs.ResponseWriter {
+	return &rs.View{FS: p.viewFS}
+}
+
+func (u *urlService) Routes() []rs.Route {
+	return []rs.Route{
+		{Handler: "ReadUser", Path: "users/{id:int}", Methods: []string{http.MethodGet}},
+		{Handler: "CreateUser", Path: "users", Methods: []string{http.MethodPost}},
+	}
+}
+
+func (u *urlService) ReadUser(id int64) int64 {
+	return id
+}
+
+func (u *urlService) CreateUser() {}
+
+func (u *urlService) Files_Any() {}
+
+func TestHandlerURL(t *testing.T) {
+	viewFS := fstest.MapFS{
+		"index.html": &fstest.MapFile{
+			Data: []byte(`{{ url "urlService.ReadUser" "id" 7 }}`),
+		},
+	}
+	h := rs.NewHandler(&urlService{Pages: urlPages{viewFS: viewFS}})
+	h.WithPrefix("/api")
+
+	tests := []struct {
+		name    string
+		params  map[string]string
+		want    string
+		wantErr bool
+	}{
+		{"urlService.ReadUser", map[string]string{"id": "7"}, "/api/users/7", false},
+		{"github.com/altlimit/restruct_test.urlService.ReadUser", map[string]string{"id": "8"}, "/api/users/8", false},
+		{"urlService.ReadUser", nil, "", true},
+		{"urlService.ReadUser", map[string]string{"id": "abc"}, "", true},
+		{"urlService.CreateUser", nil, "/api/users", false},
+		{"urlService.Files_Any", map[string]string{"any": "a b/c"}, "/api/files/a%20b/c", false},
+		{"urlService.Missing", nil, "", true},
+	}
+	for _, tc := range tests {
+		got, err := h.URL(tc.name, tc.params)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("URL(%s) error %v, wantErr %v", tc.name, err, tc.wantErr)
+		}
+		if got != tc.want {
+			t.Errorf("URL(%s) want %q got %q", tc.name, tc.want, got)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/pages", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if body := w.Body.String(); body != "/api/users/7" {
+		t.Errorf("url template func want /api/users/7 got %q", body)
+	}
+}
+
+type methodsService struct{}
+
+func (m *methodsService) Init(h *rs.Handler) {
+	h.PathArgs = true
+}
+
+func (m *methodsService) Routes() []rs.Route {
+	return []rs.Route{
+		{Handler: "Read", Path: "items/{id}", Methods: []string{http.MethodGet}},
+		{Handler: "Update", Path: "items/{id}", Methods: []string{http.MethodPut}},
+		{Handler: "Delete", Path: "items/{id}", Methods: []string{http.MethodDelete}},
+		{Handler: "Create", Path: "items", Methods: []string{http.MethodPost}},
+	}
+}
+
+func (m *methodsService) Read(id string) string {
+	return "read " + id
+}
+
+func (m *methodsService) Update(id string) string {
+	return "update " + id
+}
+
+func (m *methodsService) Delete(id string) string {
+	return "delete " + id
+}
+
+func (m *methodsService) Create() string {
+	return "create"
+}
+
+func TestAutoOptionsHead(t *testing.T) {
+	h := rs.NewHandler(&methodsService{})
+	h.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Global", "1")
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	tests := []struct {
+		method     string
+		path       string
+		wantStatus int
+		wantAllow  string
+		wantBody   string
+	}{
+		{http.MethodGet, "/items/1", 200, "", `"read 1"`},
+		{http.MethodHead, "/items/1", 200, "", ``},
+		{http.MethodPost, "/items/1", 405, "DELETE, GET, HEAD, OPTIONS, PUT", `{"error":"Method Not Allowed"}`},
+		{http.MethodOptions, "/items/1", 204, "DELETE, GET, HEAD, OPTIONS, PUT", ``},
+		{http.MethodOptions, "/items", 204, "OPTIONS, POST", ``},
+		{http.MethodHead, "/items", 405, "OPTIONS, POST", `{"error":"Method Not Allowed"}`},
+		{http.MethodOptions, "/missing", 404, "", `{"error":"Not Found"}`},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		res := w.Result()
+		data, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		body := strings.TrimRight(string(data), "\n")
+
+		if res.StatusCode != tc.wantStatus {
+			t.Errorf("%s %s: want status %d, got %d", tc.method, tc.path, tc.wantStatus, res.StatusCode)
+		}
+		if allow := res.Header.Get("Allow"); allow != tc.wantAllow {
+			t.Errorf("%s %s: want Allow %q, got %q", tc.method, tc.path, tc.wantAllow, allow)
+		}
+		if body != tc.wantBody {
+			t.Errorf("%s %s: want body %q, got %q", tc.method, tc.path, tc.wantBody, body)
+		}
+		if tc.method == http.MethodOptions && tc.wantStatus == 204 && res.Header.Get("X-Global") != "1" {
+			t.Errorf("%s %s: want global middleware to run", tc.method, tc.path)
+		}
+	}
+}
+
+type conflictService struct{}
+
+func (c *conflictService) Routes() []rs.Route {
+	return []rs.Route{
+		{Handler: "Read", Path: "items/{id}", Methods: []string{http.MethodGet}},
+		{Handler: "Show", Path: "items/{itemID}", Methods: []string{http.MethodGet, http.MethodPost}},
+		{Handler: "Update", Path: "items/{id}", Methods: []string{http.MethodPut}},
+		{Handler: "Files", Path: "files/{path*}/edit"},
+	}
+}
+
+func (c *conflictService) Read()   {}
+func (c *conflictService) Show()   {}
+func (c *conflictService) Update() {}
+func (c *conflictService) Files()  {}
+
+type strictService struct {
+	conflictService
+}
+
+func (s *strictService) Init(h *rs.Handler) {
+	h.Strict = true
+}
+
+func TestRouteConflicts(t *testing.T) {
+	h := rs.NewHandler(&conflictService{})
+	err := h.Validate()
+	if err == nil {
+		t.Fatal("expected route conflicts")
+	}
+	for _, want := range []string{
+		"route items/{itemID}: param {itemID} clashes with {id} in items/{id} (github.com/altlimit/restruct_test.conflictService.Read, github.com/altlimit/restruct_test.conflictService.Show)",
+		"route items/{id}: duplicate route, items/{itemID} is shadowed by items/{id} (github.com/altlimit/restruct_test.conflictService.Read, github.com/altlimit/restruct_test.conflictService.Show)",
+		"route files/{path*}/edit: parts after wildcard {path*} are unreachable (github.com/altlimit/restruct_test.conflictService.Files)",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("want conflict %q in \n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "conflictService.Update") {
+		t.Errorf("routes with different methods should not conflict \n%v", err)
+	}
+
+	if err := rs.NewHandler(&constraintService{}).Validate(); err != nil {
+		t.Errorf("want no conflicts got %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected strict mode to panic")
+		}
+	}()
+	rs.NewHandler(&strictService{})
+}
+
+func TestStrictAddService(t *testing.T) {
+	h := rs.NewHandler(&methodsService{})
+	h.Strict = true
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected strict mode to panic")
+			}
+		}()
+		h.AddService("bad", &conflictService{})
+	}()
+	// the failed service isn't kept so later changes still work
+	h.AddService("calc", new(Calculator))
+	h.AddService("bad", &methodsService{})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/bad/items/1", nil))
+	if w.Code != 200 {
+		t.Errorf("want 200 got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRouteInfos(t *testing.T) {
+	viewFS := fstest.MapFS{
+		"index.html": &fstest.MapFile{Data: []byte("home")},
+	}
+	h := rs.NewHandler(&urlService{Pages: urlPages{viewFS: viewFS}})
+	h.Use(execMiddleware)
+
+	var found bool
+	for _, ri := range h.RouteInfos() {
+		switch ri.Location {
+		case "github.com/altlimit/restruct_test.urlService.ReadUser":
+			found = true
+			if ri.Path != "/users/{id:int}" {
+				t.Errorf("want path /users/{id:int} got %s", ri.Path)
+			}
+			if strings.Join(ri.PathParts, "/") != "users/{id:int}" {
+				t.Errorf("want path parts users/{id:int} got %v", ri.PathParts)
+			}
+			if len(ri.Params) != 1 || ri.Params[0] != "id" {
+				t.Errorf("want params [id] got %v", ri.Params)
+			}
+			if len(ri.Methods) != 1 || ri.Methods[0] != http.MethodGet {
+				t.Errorf("want methods [GET] got %v", ri.Methods)
+			}
+			if len(ri.ParamTypes) != 1 || ri.ParamTypes[0].Kind() != reflect.Int64 {
+				t.Errorf("want param types [int64] got %v", ri.ParamTypes)
+			}
+			if len(ri.ReturnTypes) != 1 || ri.ReturnTypes[0].Kind() != reflect.Int64 {
+				t.Errorf("want return types [int64] got %v", ri.ReturnTypes)
+			}
+			if ri.Middlewares != 1 || ri.View {
+				t.Errorf("want 1 middleware and not view got %d %v", ri.Middlewares, ri.View)
+			}
+		case "":
+			if !ri.View || ri.Path != "/pages/" {
+				t.Errorf("want view route /pages/ got %v %s", ri.View, ri.Path)
+			}
+			if len(ri.ReturnTypes) != 1 {
+				t.Errorf("want view route 1 return got %v", ri.ReturnTypes)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("ReadUser route not found")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/routes", nil)
+	w := httptest.NewRecorder()
+	h.RoutesHandler().ServeHTTP(w, req)
+	var infos []map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &infos); err != nil {
+		t.Fatalf("json.Unmarshal error %v", err)
+	}
+	if len(infos) != len(h.Routes()) {
+		t.Errorf("want %d routes got %d", len(h.Routes()), len(infos))
+	}
+	if !strings.Contains(w.Body.String(), `"paramTypes":["int64"]`) {
+		t.Errorf("want paramTypes in json got %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/debug/routes", nil)
+	req.Header.Set("Accept", "text/html")
+	w = httptest.NewRecorder()
+	h.RoutesHandler().ServeHTTP(w, req)
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("want text/html got %s", ct)
+	}
+	if !strings.Contains(w.Body.String(), "/users/{id:int}") {
+		t.Errorf("want route in html got %s", w.Body.String())
+	}
+}
+
+type metaService struct{}
+
+func (m *metaService) Routes() []rs.Route {
+	return []rs.Route{
+		{Handler: "Legacy", Path: "old/{id}", Name: "legacy", Summary: "Old endpoint", Tags: []string{"admin"}, Deprecated: true,
+			Meta: map[string]any{"sunset": "2027-01-01"}},
+	}
+}
+
+func (m *metaService) Metadata() map[string]rs.Route {
+	return map[string]rs.Route{
+		"Status": {Name: "status", Summary: "Service status", Tags: []string{"public"}},
+	}
+}
+
+func (m *metaService) Legacy(ctx context.Context) string {
+	return rs.GetRoute(ctx).Summary
+}
+
+func (m *metaService) Status(ctx context.Context) string {
+	return rs.GetRoute(ctx).Summary
+}
+
+func TestRouteMetadata(t *testing.T) {
+	h := rs.NewHandler(&metaService{})
+	h.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := rs.GetRoute(r.Context())
+			if route.Deprecated {
+				w.Header().Set("Deprecation", "true")
+				w.Header().Set("Sunset", route.Meta["sunset"].(string))
+			}
+			if route.HasTag("admin") && r.Header.Get("Authorization") != "admin" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	tests := []struct {
+		path       string
+		auth       string
+		wantStatus int
+		wantBody   string
+		wantSunset string
+	}{
+		{"/old/1", "", 401, ``, "2027-01-01"},
+		{"/old/1", "admin", 200, `"Old endpoint"`, "2027-01-01"},
+		{"/status", "", 200, `"Service status"`, ""},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		body := strings.TrimRight(w.Body.String(), "\n")
+		if w.Code != tc.wantStatus || body != tc.wantBody {
+			t.Errorf("path %s: want %d %q got %d %q", tc.path, tc.wantStatus, tc.wantBody, w.Code, body)
+		}
+		if sunset := w.Header().Get("Sunset"); sunset != tc.wantSunset {
+			t.Errorf("path %s: want Sunset %q got %q", tc.path, tc.wantSunset, sunset)
+		}
+	}
+
+	if u, err := h.URL("legacy", map[string]string{"id": "5"}); err != nil || u != "/old/5" {
+		t.Errorf("want /old/5 got %s %v", u, err)
+	}
+	for _, ri := range h.RouteInfos() {
+		if ri.Path == "/status" && (ri.Name != "status" || ri.Tags[0] != "public") {
+			t.Errorf("want status route metadata got %+v", ri)
+		}
+		if ri.Path == "/old/{id}" && (!ri.Deprecated || ri.Meta["sunset"] != "2027-01-01") {
+			t.Errorf("want legacy route metadata got %+v", ri)
+		}
+	}
+}
+
+func TestMiddlewareChainBuiltOnce(t *testing.T) {
+	var built, calls int
+	counting := func(next http.Handler) http.Handler {
+		built++
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			next.ServeHTTP(w, r)
+		})
+	}
+	h := rs.NewHandler(&methodsService{})
+	h.Use(counting)
+	// one chain per route plus the automatic OPTIONS handler
+	routes := len(h.Routes()) + 1
+	if built != routes {
+		t.Errorf("want middleware built %d times got %d", routes, built)
+	}
+	for i := 0; i < 3; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/1", nil))
+	}
+	if built != routes || calls != 3 {
+		t.Errorf("want middleware built %d times and called 3 times got %d %d", routes, built, calls)
+	}
+
+	var added int
+	h.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			added++
+			next.ServeHTTP(w, r)
+		})
+	})
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/1", nil))
+	if added != 1 || calls != 4 {
+		t.Errorf("want middleware added with Use to run got %d %d", added, calls)
+	}
+}
+
+func TestRuntimeServices(t *testing.T) {
+	h := rs.NewHandler(&methodsService{})
+	noop := func(next http.Handler) http.Handler { return next }
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items/1", nil))
+				if w.Code != http.StatusOK {
+					t.Errorf("want 200 got %d", w.Code)
+					return
+				}
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/calc/add", strings.NewReader(`{"a":1,"b":2}`)))
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		h.AddService("calc", new(Calculator))
+		h.Use(noop)
+		h.WithPrefix("/")
+		if !h.RemoveService("/calc/") {
+			t.Error("want calc service removed")
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if h.RemoveService("calc") {
+		t.Error("want no calc service to remove")
+	}
+	h.AddService("calc", new(Calculator))
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/calc/add", strings.NewReader(`{"a":1,"b":2}`))
+	req.Header.Set("Content-Type", "application/json")
+	h.Freeze().ServeHTTP(w, req)
+	if body := strings.TrimRight(w.Body.String(), "\n"); body != "3" {
+		t.Errorf("want 3 got %s", body)
+	}
+
+	for name, fn := range map[string]func(){
+		"AddService":    func() { h.AddService("other", new(Calculator)) },
+		"RemoveService": func() { h.RemoveService("calc") },
+		"Use":           func() { h.Use(noop) },
+		"WithPrefix":    func() { h.WithPrefix("/api") },
+	} {
+		func() {
+			defer func() {
+				if err := recover(); err != rs.ErrFrozen {
+					t.Errorf("%s: want ErrFrozen panic got %v", name, err)
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+type mountService struct {
+	Proxy  http.Handler `route:"proxy"`
+	Status http.HandlerFunc
+	Nil    http.Handler
+}
+
+func (m *mountService) Middlewares() []rs.Middleware {
+	return []rs.Middleware{func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Service", "1")
+			next.ServeHTTP(w, r)
+		})
+	}}
+}
+
+func (m *mountService) Routes() []rs.Route {
+	return []rs.Route{
+		{Handler: http.HandlerFunc(echoPath), Path: "admin", Methods: []string{http.MethodGet}},
+	}
+}
+
+func echoPath(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(r.URL.Path))
+}
+
+func TestMountHandlers(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", echoPath)
+	h := rs.NewHandler(&mountService{Proxy: mux, Status: echoPath})
+	h.WithPrefix("/api")
+	h.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Global", "1")
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	tests := []struct {
+		method     string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{http.MethodGet, "/api/proxy", 200, "/"},
+		{http.MethodGet, "/api/proxy/", 200, "/"},
+		{http.MethodGet, "/api/proxy/a/b", 200, "/a/b"},
+		{http.MethodPost, "/api/status/x", 200, "/x"},
+		{http.MethodGet, "/api/admin/users", 200, "/users"},
+		{http.MethodPost, "/api/admin/users", 405, `{"error":"Method Not Allowed"}`},
+		{http.MethodGet, "/api/nil", 404, `{"error":"Not Found"}`},
+	}
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		body := strings.TrimRight(w.Body.String(), "\n")
+		if w.Code != tc.wantStatus || body != tc.wantBody {
+			t.Errorf("%s %s: want %d %q got %d %q", tc.method, tc.path, tc.wantStatus, tc.wantBody, w.Code, body)
+		}
+		if w.Code == 200 && (w.Header().Get("X-Global") != "1" || w.Header().Get("X-Service") != "1") {
+			t.Errorf("%s %s: want global and service middlewares", tc.method, tc.path)
+		}
+	}
+
+	routes := strings.Join(h.Routes(), "\n")
+	for _, want := range []string{
+		"/api/proxy/{any*} [*] -> github.com/altlimit/restruct_test.mountService.Proxy(http.ResponseWriter, *http.Request)",
+		"/api/admin [GET] -> github.com/altlimit/restruct_test.echoPath(http.ResponseWriter, *http.Request)",
+	} {
+		if !strings.Contains(routes, want) {
+			t.Errorf("want route %s in \n%s", want, routes)
+		}
+	}
+}
+
+type hostAPI struct{}
+
+func (hostAPI) Info(ctx context.Context) map[string]string {
+	return rs.Vars(ctx)
+}
+
+type hostAdmin struct{}
+
+func (hostAdmin) Info() string {
+	return "admin"
+}
+
+type hostService struct {
+	Admin  hostAdmin `host:"admin.example.com" route:"/"`
+	Tenant hostAPI   `host:"{tenant:alpha}.example.com" route:"/"`
+}
+
+func (hostService) Info() string {
+	return "default"
+}
+
+func TestHostRouting(t *testing.T) {
+	h := rs.NewHandler(&hostService{})
+	h.AddServiceHost("api.example.com", "v1/{version}", &hostAPI{})
+
+	tests := []struct {
+		host     string
+		path     string
+		wantBody string
+	}{
+		{"admin.example.com", "/info", `"admin"`},
+		{"ADMIN.example.com:8080", "/info", `"admin"`},
+		{"acme.example.com", "/info", `{"tenant":"acme"}`},
+		{"api.example.com", "/v1/2/info", `{"version":"2"}`},
+		{"api.example.com", "/info", `{"tenant":"api"}`},
+		{"123.example.com", "/info", `"default"`},
+		{"example.com", "/info", `"default"`},
+		{"a.b.example.com", "/info", `"default"`},
+	}
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.Host = tc.host
+		h.ServeHTTP(w, req)
+		body := strings.TrimRight(w.Body.String(), "\n")
+		if w.Code != 200 || body != tc.wantBody {
+			t.Errorf("%s%s: want 200 %q got %d %q", tc.host, tc.path, tc.wantBody, w.Code, body)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v1/2/info", nil)
+	req.Host = "example.com"
+	h.ServeHTTP(w, req)
+	if w.Code != 404 {
+		t.Errorf("want 404 for host route on another host got %d", w.Code)
+	}
+
+	if err := h.Validate(); err != nil {
+		t.Errorf("want no conflicts across hosts got %v", err)
+	}
+	routes := strings.Join(h.Routes(), "\n")
+	for _, want := range []string{
+		"admin.example.com/info [*] -> github.com/altlimit/restruct_test.hostAdmin.Info() (string)",
+		"{tenant:alpha}.example.com/info [*] -> github.com/altlimit/restruct_test.hostAPI.Info(context.Context) (map[string]string)",
+		"api.example.com/v1/{version}/info [*]",
+		"/info [*] -> github.com/altlimit/restruct_test.hostService.Info() (string)",
+	} {
+		if !strings.Contains(routes, want) {
+			t.Errorf("want route %s in \n%s", want, routes)
+		}
+	}
+}
+
+type verbService struct{}
+
+func (verbService) Init(h *rs.Handler) {
+	h.VerbMethods = true
+	h.PathArgs = true
+}
+
+func (verbService) GetUsers() string {
+	return "list"
+}
+
+func (verbService) PostUsers() string {
+	return "create"
+}
+
+func (verbService) GetUsers_0(id int) int {
+	return id
+}
+
+func (verbService) DeleteUsers_0(id int) string {
+	return "delete"
+}
+
+func (verbService) Status() string {
+	return "ok"
+}
+
+func TestVerbMethods(t *testing.T) {
+	h := rs.NewHandler(&verbService{})
+	tests := []struct {
+		method     string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{http.MethodGet, "/users", 200, `"list"`},
+		{http.MethodPost, "/users", 200, `"create"`},
+		{http.MethodGet, "/users/7", 200, `7`},
+		{http.MethodDelete, "/users/7", 200, `"delete"`},
+		{http.MethodPut, "/users/7", 405, `{"error":"Method Not Allowed"}`},
+		{http.MethodPatch, "/status", 200, `"ok"`},
+		{http.MethodGet, "/get-users", 404, `{"error":"Not Found"}`},
+	}
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		body := strings.TrimRight(w.Body.String(), "\n")
+		if w.Code != tc.wantStatus || body != tc.wantBody {
+			t.Errorf("%s %s: want %d %q got %d %q", tc.method, tc.path, tc.wantStatus, tc.wantBody, w.Code, body)
+		}
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/users/7", nil))
+	if allow := w.Header().Get("Allow"); allow != "DELETE, GET, HEAD, OPTIONS" {
+		t.Errorf("want Allow DELETE, GET, HEAD, OPTIONS got %s", allow)
+	}
+	if err := h.Validate(); err != nil {
+		t.Errorf("want no conflicts got %v", err)
+	}
+}
+
+type legacyService struct{}
+
+func (legacyService) NameMapper() rs.NameMapper {
+	return func(s string) string { return s }
+}
+
+func (legacyService) GetUser_0(id string) string {
+	return id
+}
+
+type namingService struct {
+	LineItems legacyService
+	Orders    struct{ SubTotal legacyService }
+}
+
+func (namingService) Init(h *rs.Handler) {
+	h.NameMapper = rs.SnakeCase
+	h.PathArgs = true
+}
+
+func (namingService) UsersExport() string {
+	return "export"
+}
+
+func TestNameMapper(t *testing.T) {
+	h := rs.NewHandler(&namingService{})
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/users_export", 200, `"export"`},
+		{"/users-export", 404, `{"error":"Not Found"}`},
+		{"/line_items/GetUser/1", 200, `"1"`},
+		{"/orders/sub_total/GetUser/2", 200, `"2"`},
+	}
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		body := strings.TrimRight(w.Body.String(), "\n")
+		if w.Code != tc.wantStatus || body != tc.wantBody {
+			t.Errorf("%s: want %d %q got %d %q", tc.path, tc.wantStatus, tc.wantBody, w.Code, body)
+		}
+	}
+}
+
+type muxService struct{}
+
+func (muxService) Routes() []rs.Route {
+	return []rs.Route{
+		{Handler: "Item", Path: "items/{id:int}", Methods: []string{http.MethodGet}},
+		{Handler: "Slug", Path: "items/{slug:alpha}"},
+	}
+}
+
+func muxValues(r *http.Request, names ...string) string {
+	out := r.Pattern
+	for _, name := range names {
+		out += " " + r.PathValue(name) + "=" + rs.Vars(r.Context())[name]
+	}
+	return out
+}
+
+func (muxService) Index(r *http.Request) string {
+	return muxValues(r)
+}
+
+func (muxService) Users_0(r *http.Request) string {
+	return muxValues(r, "0")
+}
+
+func (muxService) Item(r *http.Request) string {
+	return muxValues(r, "id")
+}
+
+func (muxService) Slug(r *http.Request) string {
+	return muxValues(r, "slug")
+}
+
+func (muxService) Files_Any(r *http.Request) string {
+	return muxValues(r, "any")
+}
+
+func TestRegisterMux(t *testing.T) {
+	h := rs.NewHandler(&muxService{})
+	h.WithPrefix("/api")
+	mux := http.NewServeMux()
+	h.RegisterMux(mux)
+
+	tests := []struct {
+		method     string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{http.MethodGet, "/api/", 200, `"/api/{$}"`},
+		{http.MethodGet, "/api/users/7", 200, `"/api/users/{_0} 7=7"`},
+		{http.MethodGet, "/api/items/12", 200, `"/api/items/{id} 12=12"`},
+		{http.MethodPost, "/api/items/abc", 200, `"/api/items/{id} abc=abc"`},
+		{http.MethodPost, "/api/items/12", 405, `{"error":"Method Not Allowed"}`},
+		{http.MethodGet, "/api/items/a1", 404, `{"error":"Not Found"}`},
+		{http.MethodGet, "/api/files/a/b.txt", 200, `"/api/files/{any...} a/b.txt=a/b.txt"`},
+		{http.MethodHead, "/api/items/12", 200, ``},
+	}
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		body := strings.TrimRight(w.Body.String(), "\n")
+		if w.Code != tc.wantStatus || body != tc.wantBody {
+			t.Errorf("%s %s: want %d %q got %d %q", tc.method, tc.path, tc.wantStatus, tc.wantBody, w.Code, body)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/api/items/12", nil))
+	if w.Code != 204 || w.Header().Get("Allow") != "GET, HEAD, OPTIONS" {
+		t.Errorf("want 204 with Allow got %d %s", w.Code, w.Header().Get("Allow"))
+	}
+}
+
+type segmentService struct{}
+
+func (segmentService) Init(h *rs.Handler) {
+	h.PathArgs = true
+}
+
+func (segmentService) Routes() []rs.Route {
+	return []rs.Route{
+		{Handler: "File", Path: "files/{name}.{ext}"},
+		{Handler: "FileID", Path: "files/{id:int}"},
+		{Handler: "Latest", Path: "files/latest.json"},
+		{Handler: "Items", Path: "v{version:int}/items"},
+		{Handler: "ItemsMinor", Path: "v{major:int}.{minor:int}/items"},
+		{Handler: "User", Path: "@{username}"},
+	}
+}
+
+func (segmentService) File(ctx context.Context) string {
+	return "file:" + rs.Vars(ctx)["name"] + "|" + rs.Vars(ctx)["ext"]
+}
+
+func (segmentService) FileID(id int) string {
+	return fmt.Sprintf("id:%d", id)
+}
+
+func (segmentService) Latest() string {
+	return "latest"
+}
+
+func (segmentService) Items(version int) string {
+	return fmt.Sprintf("items:%d", version)
+}
+
+func (segmentService) ItemsMinor(major, minor int) string {
+	return fmt.Sprintf("items:%d.%d", major, minor)
+}
+
+func (segmentService) User(ctx context.Context) string {
+	return "user:" + rs.Vars(ctx)["username"]
+}
+
+func TestPartialSegments(t *testing.T) {
+	h := rs.NewHandler(&segmentService{})
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/files/report.pdf", 200, `"file:report|pdf"`},
+		{"/files/archive.tar.gz", 200, `"file:archive.tar|gz"`},
+		{"/files/latest.json", 200, `"latest"`},
+		{"/files/42", 200, `"id:42"`},
+		{"/files/.pdf", 404, `{"error":"Not Found"}`},
+		{"/v2/items", 200, `"items:2"`},
+		{"/v2.1/items", 200, `"items:2.1"`},
+		{"/vx/items", 404, `{"error":"Not Found"}`},
+		{"/@alice", 200, `"user:alice"`},
+		{"/@", 404, `{"error":"Not Found"}`},
+	}
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		body := strings.TrimRight(w.Body.String(), "\n")
+		if w.Code != tc.wantStatus || body != tc.wantBody {
+			t.Errorf("%s: want %d %q got %d %q", tc.path, tc.wantStatus, tc.wantBody, w.Code, body)
+		}
+	}
+
+	if u, err := h.URL("segmentService.File", map[string]string{"name": "a b", "ext": "txt"}); err != nil || u != "/files/a%20b.txt" {
+		t.Errorf("want /files/a%%20b.txt got %s %v", u, err)
+	}
+	if _, err := h.URL("segmentService.File", map[string]string{"name": "a", "ext": "tar.gz"}); err == nil {
+		t.Error("want error for ext that doesn't match back")
+	}
+	if err := h.Validate(); err != nil {
+		t.Errorf("want no conflicts got %v", err)
+	}
+}
+
+type predicateService struct{}
+
+func (predicateService) Routes() []rs.Route {
+	return []rs.Route{
+		{Handler: "ListV2", Path: "items", Headers: map[string]string{"X-Api-Version": "2"}},
+		{Handler: "ListCSV", Path: "items", Query: map[string]string{"format": "csv"}},
+		{Handler: "List", Path: "items", Methods: []string{http.MethodGet}},
+		{Handler: "CreateJSON", Path: "items", Methods: []string{http.MethodPost}, Consumes: []string{"application/json"}},
+		{Handler: "CreateImage", Path: "items", Methods: []string{http.MethodPost}, Consumes: []string{"image/*"}},
+		{Handler: "Beta", Path: "beta", Match: func(r *http.Request) bool {
+			_, err := r.Cookie("beta")
+			return err == nil
+		}},
+	}
+}
+
+func (predicateService) ListV2() string      { return "v2" }
+func (predicateService) ListCSV() string     { return "csv" }
+func (predicateService) List() string        { return "list" }
+func (predicateService) CreateJSON() string  { return "json" }
+func (predicateService) CreateImage() string { return "image" }
+func (predicateService) Beta() string        { return "beta" }
+
+func TestRoutePredicates(t *testing.T) {
+	h := rs.NewHandler(&predicateService{})
+	tests := []struct {
+		method      string
+		path        string
+		header      string
+		headerValue string
+		wantStatus  int
+		wantBody    string
+	}{
+		{http.MethodGet, "/items", "", "", 200, `"list"`},
+		{http.MethodGet, "/items", "X-Api-Version", "2", 200, `"v2"`},
+		{http.MethodGet, "/items", "X-Api-Version", "3", 200, `"list"`},
+		{http.MethodGet, "/items?format=csv", "", "", 200, `"csv"`},
+		{http.MethodPost, "/items", "Content-Type", "application/json; charset=utf-8", 200, `"json"`},
+		{http.MethodPost, "/items", "Content-Type", "image/png", 200, `"image"`},
+		{http.MethodPost, "/items", "Content-Type", "text/plain", 415, `{"error":"Unsupported Media Type"}`},
+		{http.MethodGet, "/beta", "", "", 404, `{"error":"Not Found"}`},
+		{http.MethodGet, "/beta", "Cookie", "beta=1", 200, `"beta"`},
+	}
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		if tc.header != "" {
+			req.Header.Set(tc.header, tc.headerValue)
+		}
+		h.ServeHTTP(w, req)
+		body := strings.TrimRight(w.Body.String(), "\n")
+		if w.Code != tc.wantStatus || body != tc.wantBody {
+			t.Errorf("%s %s %s: want %d %q got %d %q", tc.method, tc.path, tc.headerValue, tc.wantStatus, tc.wantBody, w.Code, body)
+		}
+	}
+	if err := h.Validate(); err != nil {
+		t.Errorf("want no conflicts got %v", err)
+	}
+}
+
+type usersV1 struct{}
+
+func (usersV1) Users(ctx context.Context) string {
+	return fmt.Sprintf("users v1 %d", rs.GetVersion(ctx))
+}
+
+func (usersV1) Orders() string {
+	return "orders v1"
+}
+
+// Version is a route, not the API version
+func (usersV1) Version() int {
+	return 7
+}
+
+type usersV2 struct{}
+
+func (usersV2) APIVersion() int {
+	return 2
+}
+
+func (usersV2) Users(ctx context.Context) string {
+	return fmt.Sprintf("users v2 %d", rs.GetVersion(ctx))
+}
+
+type versionService struct {
+	V1 usersV1 `route:"/" version:"1"`
+	V2 usersV2 `route:"/"`
+}
+
+func (versionService) Init(h *rs.Handler) {
+	h.VersionHeader = "X-Api-Version"
+}
+
+func TestVersioning(t *testing.T) {
+	h := rs.NewHandler(&versionService{})
+	tests := []struct {
+		path     string
+		header   string
+		value    string
+		wantBody string
+	}{
+		{"/users", "", "", `"users v2 2"`},
+		{"/users", "Accept", "application/vnd.app.v1+json", `"users v1 1"`},
+		{"/users", "Accept", "application/vnd.app.v2+json", `"users v2 2"`},
+		{"/users", "Accept", "application/json; version=3", `"users v2 2"`},
+		{"/users", "X-Api-Version", "1", `"users v1 1"`},
+		{"/orders", "X-Api-Version", "2", `"orders v1"`},
+		{"/version", "", "", `7`},
+	}
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if tc.header != "" {
+			req.Header.Set(tc.header, tc.value)
+		}
+		h.ServeHTTP(w, req)
+		body := strings.TrimRight(w.Body.String(), "\n")
+		if w.Code != 200 || body != tc.wantBody {
+			t.Errorf("%s %s: want 200 %q got %d %q", tc.path, tc.value, tc.wantBody, w.Code, body)
+		}
+	}
+
+	h.DefaultVersion = 1
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+	if body := strings.TrimRight(w.Body.String(), "\n"); body != `"users v1 1"` {
+		t.Errorf("want default version 1 got %s", body)
+	}
+	if err := h.Validate(); err != nil {
+		t.Errorf("want no conflicts got %v", err)
+	}
+}
+
+type typedUser struct {
+	Name string `json:"name"`
+}
+
+type typedService struct{}
+
+func (typedService) Init(h *rs.Handler) {
+	h.PathArgs = true
+}
+
+func (typedService) Routes() []rs.Route {
+	return []rs.Route{
+		{Path: "users/{id}", Methods: []string{http.MethodGet}, Handler: rs.Func(func(ctx context.Context, id int64) (*typedUser, error) {
+			if id == 0 {
+				return nil, rs.Error{Status: http.StatusNotFound}
+			}
+			return &typedUser{Name: fmt.Sprintf("user %d", id)}, nil
+		})},
+		{Path: "users", Methods: []string{http.MethodPost}, Handler: rs.Func(func(ctx context.Context, in typedUser) (typedUser, error) {
+			return in, nil
+		})},
+		{Path: "ping", Handler: rs.Action(func(ctx context.Context, r *http.Request) error {
+			return nil
+		})},
+	}
+}
+
+func TestTypedFuncs(t *testing.T) {
+	h := rs.NewHandler(&typedService{})
+	tests := []struct {
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{http.MethodGet, "/users/7", "", 200, `{"name":"user 7"}`},
+		{http.MethodGet, "/users/0", "", 404, `{"error":"Not Found"}`},
+		{http.MethodGet, "/users/x", "", 400, `{"error":"invalid path param id"}`},
+		{http.MethodPost, "/users", `{"name":"bob"}`, 200, `{"name":"bob"}`},
+		{http.MethodGet, "/ping", "", 200, ``},
+	}
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		if tc.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		h.ServeHTTP(w, req)
+		body := strings.TrimRight(w.Body.String(), "\n")
+		if w.Code != tc.wantStatus || body != tc.wantBody {
+			t.Errorf("%s %s: want %d %q got %d %q", tc.method, tc.path, tc.wantStatus, tc.wantBody, w.Code, body)
+		}
+	}
+
+	routes := strings.Join(h.Routes(), "\n")
+	for _, want := range []string{
+		"/users/{id} [GET] -> github.com/altlimit/restruct_test.typedService.Routes.func1(context.Context, int64) (*restruct_test.typedUser, error)",
+		"/users [POST] -> github.com/altlimit/restruct_test.typedService.Routes.func2(context.Context, restruct_test.typedUser) (restruct_test.typedUser, error)",
+	} {
+		if !strings.Contains(routes, want) {
+			t.Errorf("want route %s in \n%s", want, routes)
+		}
+	}
+}
+
+type stateService struct {
+	ctxs []context.Context
+}
+
+func (s *stateService) Files_0_Any(r *http.Request) string {
+	s.ctxs = append(s.ctxs, r.Context())
+	return rs.GetRoute(r.Context()).Path + " " + rs.Vars(r.Context())["any"]
+}
+
+func (s *stateService) Set(ctx context.Context) string {
+	ctx = rs.SetVars(ctx, map[string]string{"id": "9"})
+	return rs.Vars(ctx)["id"] + " " + rs.GetRoute(ctx).Path
+}
+
+func TestRequestState(t *testing.T) {
+	svc := &stateService{}
+	h := rs.NewHandler(svc)
+	tests := []struct {
+		path     string
+		wantBody string
+	}{
+		{"/files/1/a/b.txt", `"files/{0}/{any*} a/b.txt"`},
+		{"/files/2/c", `"files/{0}/{any*} c"`},
+		{"/set", `"9 set"`},
+	}
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		body := strings.TrimRight(w.Body.String(), "\n")
+		if w.Code != 200 || body != tc.wantBody {
+			t.Errorf("%s: want %q got %d %q", tc.path, tc.wantBody, w.Code, body)
+		}
+	}
+	// saved contexts keep their own state after later requests
+	want := []map[string]string{{"0": "1", "any": "a/b.txt"}, {"0": "2", "any": "c"}}
+	for i, ctx := range svc.ctxs {
+		if got := rs.Vars(ctx); !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("want vars %v got %v", want[i], got)
+		}
+		if rs.GetRoute(ctx).Path != "files/{0}/{any*}" {
+			t.Errorf("want saved route got %v", rs.GetRoute(ctx))
+		}
+	}
+}
+
+type (
+	inputService struct{}
+
+	inputRequest struct {
+		ID        int64    `path:"0" json:"-"`
+		RequestID string   `header:"X-Request-Id" json:"-"`
+		Langs     []string `header:"Accept-Language" json:"-"`
+		Session   *string  `cookie:"session" json:"-"`
+		Page      int      `query:"page" json:"-"`
+		Name      string   `json:"name"`
+	}
+)
+
+func (s *inputService) Items_0(req inputRequest) string {
+	session := "none"
+	if req.Session != nil {
+		session = *req.Session
+	}
+	return fmt.Sprintf("%d %s %v %s %d %s", req.ID, req.RequestID, req.Langs, session, req.Page, req.Name)
+}
+
+func TestBindInputs(t *testing.T) {
+	h := rs.NewHandler(&inputService{})
+	tests := []struct {
+		method     string
+		path       string
+		headers    map[string]string
+		cookie     string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{http.MethodGet, "/items/5?page=2", map[string]string{"x-request-id": "abc"}, "s1", "", 200, `"5 abc [] s1 2 "`},
+		{http.MethodGet, "/items/5", nil, "", "", 200, `"5  [] none 0 "`},
+		{http.MethodPost, "/items/6", map[string]string{"Content-Type": "application/json", "Accept-Language": "fr"}, "", `{"name":"bob"}`, 200, `"6  [fr] none 0 bob"`},
+		{http.MethodDelete, "/items/7", nil, "", "", 200, `"7  [] none 0 "`},
+		{http.MethodPut, "/items/8", nil, "", "name=bob", 415, `{"error":"Unsupported Media Type"}`},
+	}
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		for k, v := range tc.headers {
+			req.Header.Set(k, v)
+		}
+		if tc.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "session", Value: tc.cookie})
+		}
+		h.ServeHTTP(w, req)
+		body := strings.TrimRight(w.Body.String(), "\n")
+		if w.Code != tc.wantStatus || body != tc.wantBody {
+			t.Errorf("%s %s: want %d %q got %d %q", tc.method, tc.path, tc.wantStatus, tc.wantBody, w.Code, body)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package restruct
+
+import (
+	"net"
+	"sort"
+	"strings"
+)
+
+type (
+	// serviceKey identifies a service by host pattern and path
+	serviceKey struct {
+		host string
+		path string
+	}
+
+	// hostRoutes is the route trie of a host pattern such as {tenant}.example.com
+	hostRoutes struct {
+		host  string
+		parts []string
+		root  *node
+	}
+)
+
+// AddServiceHost adds a new service to specified route that only matches
+// requests for the given host. The host can have params such as
+// {tenant}.example.com or {tenant:alpha}.example.com which are merged into Vars.
+func (h *Handler) AddServiceHost(host, path string, svc interface{}) {
+	key := serviceKey{host: normalizeHost(host), path: servicePath(path)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.mustNotFreeze()
+	if _, ok := h.services[key]; ok {
+		panic("service " + key.host + "/" + key.path + " already exists")
+	}
+	h.addService(key, svc)
+}
+
+// RemoveServiceHost removes the service added with AddServiceHost.
+func (h *Handler) RemoveServiceHost(host, path string) bool {
+	key := serviceKey{host: normalizeHost(host), path: servicePath(path)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.mustNotFreeze()
+	if _, ok := h.services[key]; !ok {
+		return false
+	}
+	delete(h.services, key)
+	h.rebuild()
+	return true
+}
+
+// normalizeHost removes the trailing dot of a host pattern.
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(host, ".")
+}
+
+// requestHost lower cases the request host and removes the port and trailing dot.
+func requestHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// setHost sets the host of methods that don't have one yet, so the
+// innermost host tag wins.
+func setHost(methods []*method, host string) {
+	if host == "" {
+		return
+	}
+	host = normalizeHost(host)
+	for _, m := range methods {
+		if m.host == "" {
+			m.host = host
+		}
+	}
+}
+
+// routeKey groups methods by host and path
+func routeKey(host, path string) string {
+	if host == "" {
+		return path
+	}
+	return host + " " + path
+}
+
+// hostRoot returns the trie for a host, it panics on invalid host patterns.
+func (mc *methodCache) hostRoot(host string) *node {
+	if host == "" {
+		if mc.root == nil {
+			mc.root = &node{children: make(map[string]*node)}
+		}
+		return mc.root
+	}
+	for _, hr := range mc.hosts {
+		if hr.host == host {
+			return hr.root
+		}
+	}
+	hr := &hostRoutes{
+		host:  host,
+		parts: strings.Split(host, "."),
+		root:  &node{children: make(map[string]*node)},
+	}
+	for _, part := range hr.parts {
+		_, constraint, wildcard, ok := parseParam(part)
+		if wildcard {
+			panic("host " + host + " can't have wildcard params")
+		}
+		if ok {
+			getConstraint(constraint)
+		}
+	}
+	mc.hosts = append(mc.hosts, hr)
+	return hr.root
+}
+
+// sortHosts puts static hosts first then the ones with fewer params.
+func (mc *methodCache) sortHosts() {
+	params := func(hr *hostRoutes) (n int) {
+		for _, part := range hr.parts {
+			if _, _, _, ok := parseParam(part); ok {
+				n++
+			}
+		}
+		return
+	}
+	sort.SliceStable(mc.hosts, func(i, j int) bool {
+		pi, pj := params(mc.hosts[i]), params(mc.hosts[j])
+		if pi != pj {
+			return pi < pj
+		}
+		if len(mc.hosts[i].parts) != len(mc.hosts[j].parts) {
+			return len(mc.hosts[i].parts) > len(mc.hosts[j].parts)
+		}
+		return mc.hosts[i].host < mc.hosts[j].host
+	})
+}
+
+// match returns the host params if the request host matches the pattern.
+func (hr *hostRoutes) match(host string) (map[string]string, bool) {
+	var params map[string]string
+	for _, part := range hr.parts {
+		var label string
+		if idx := strings.IndexByte(host, '.'); idx == -1 {
+			label, host = host, ""
+		} else {
+			label, host = host[:idx], host[idx+1:]
+		}
+		if label == "" {
+			return nil, false
+		}
+		name, constraint, _, ok := parseParam(part)
+		if !ok {
+			if !strings.EqualFold(part, label) {
+				return nil, false
+			}
+			continue
+		}
+		if c := getConstraint(constraint); c != nil && !c.match(label) {
+			return nil, false
+		}
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params[name] = label
+	}
+	if host != "" {
+		return nil, false
+	}
+	return params, true
+}
+
+// search looks up the routes of matching hosts first then the routes
+// without a host.
+func (mc *methodCache) search(host, path string) ([]*method, map[string]string) {
+	if len(mc.hosts) > 0 {
+		host = requestHost(host)
+		for _, hr := range mc.hosts {
+			hostParams, ok := hr.match(host)
+			if !ok {
+				continue
+			}
+			if methods := hr.root.search(path); methods != nil {
+				return methods, hostParams
+			}
+		}
+	}
+	if mc.root == nil {
+		return nil, nil
+	}
+	return mc.root.search(path), nil
+}
@@ -2,12 +2,13 @@ package restruct
 
 import (
 	"context"
+	"fmt"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"reflect"
 	"runtime"
 	"strings"
-	"unicode"
 )
 
 var (
@@ -27,6 +28,7 @@ type (
 		source        reflect.Value
 		path          string
 		pathParts     []string
+		host          string // host pattern, empty matches any host
 		params        []reflect.Type
 		returns       []reflect.Type
 		methods       map[string]bool
@@ -34,11 +36,19 @@ type (
 		writer        ResponseWriter
 		readerTypes   []reflect.Type // Pre-computed types for RequestReader
 		readerIndexes []int          // Pre-computed indexes for RequestReader args
+		pathIndexes   []int          // Pre-computed indexes for path param args
+		pathNames     []string       // Path param names for each of pathIndexes
+		view          bool           // route registered from a View file
+		route         *Route         // matched route with metadata, Path is set to path
+		matcher       *routeMatcher  // route predicates, nil if none
+		version       int            // API version, 0 if not versioned
+		invoke        invoker        // calls source without reflection when set
+		handler       http.Handler   // pre-built middleware chain, see Handler.buildChains
 	}
 )
 
 // returns methods from structs and nested structs
-func serviceToMethods(prefix string, svc interface{}) (methods []*method) {
+func serviceToMethods(prefix string, svc interface{}, nm naming) (methods []*method) {
 	tv := reflect.TypeOf(svc)
 	vv := reflect.ValueOf(svc)
 
@@ -59,12 +69,52 @@ func serviceToMethods(prefix string, svc interface{}) (methods []*method) {
 		writer = v.Writer()
 		skipMethods["Writer"] = true
 	}
+	version := 0
+	if v, ok := svc.(Versioned); ok {
+		version = v.APIVersion()
+		skipMethods["APIVersion"] = true
+	}
+	if _, ok := svc.(Namer); ok {
+		nm = nm.forService(svc)
+		skipMethods["NameMapper"] = true
+	}
+	var meta map[string]Route
+	if md, ok := svc.(Metadata); ok {
+		meta = md.Metadata()
+		skipMethods["Metadata"] = true
+	}
 	var funcMethods []*method
 	if router, ok := svc.(Router); ok {
 		for _, route := range router.Routes() {
-			switch h := route.Handler.(type) {
+			handler := route.Handler
+			var invoke invoker
+			if tf, ok := handler.(TypedFunc); ok {
+				handler, invoke = tf.fn, tf.invoke
+			}
+			switch h := handler.(type) {
 			case string:
 				routes[h] = append(routes[h], route)
+			case http.Handler:
+				path := strings.TrimRight(prefix, "/")
+				if route.Path != "." {
+					if route.Path == "" {
+						panic("Route.Handler http.Handler requires a Path")
+					}
+					path = prefix + strings.Trim(route.Path, "/")
+				}
+				for _, m := range mountHandler(path, handlerLocation(h), h) {
+					m.middlewares = append(m.middlewares, middlewares...)
+					m.middlewares = append(m.middlewares, route.Middlewares...)
+					m.writer = writer
+					if len(route.Methods) > 0 {
+						m.methods = make(map[string]bool)
+						for _, method := range route.Methods {
+							m.methods[method] = true
+						}
+					}
+					m.setRoute(route)
+					funcMethods = append(funcMethods, m)
+				}
 			default:
 				rv := reflect.ValueOf(h)
 				if rv.Kind() != reflect.Func {
@@ -77,6 +127,7 @@ func serviceToMethods(prefix string, svc interface{}) (methods []*method) {
 					source:      rv,
 					middlewares: middlewares,
 					writer:      writer,
+					invoke:      invoke,
 				}
 				m.middlewares = append(m.middlewares, route.Middlewares...)
 				if route.Path != "" {
@@ -93,6 +144,7 @@ func serviceToMethods(prefix string, svc interface{}) (methods []*method) {
 					}
 				}
 				m.mustParse()
+				m.setRoute(route)
 				funcMethods = append(funcMethods, m)
 			}
 		}
@@ -117,6 +169,7 @@ func serviceToMethods(prefix string, svc interface{}) (methods []*method) {
 			source:      vv.Method(i),
 			middlewares: middlewares,
 			writer:      writer,
+			invoke:      lookupInvoker(tv, m.Name, svc),
 		}
 		if len(routes) > 0 {
 			rts, ok := routes[m.Name]
@@ -128,6 +181,7 @@ func serviceToMethods(prefix string, svc interface{}) (methods []*method) {
 						source:      mm.source,
 						middlewares: mm.middlewares,
 						writer:      mm.writer,
+						invoke:      mm.invoke,
 					}
 					mr.middlewares = append(mr.middlewares, route.Middlewares...)
 					if route.Path != "" {
@@ -137,7 +191,11 @@ func serviceToMethods(prefix string, svc interface{}) (methods []*method) {
 							mr.path = prefix + strings.TrimLeft(route.Path, "/")
 						}
 					} else {
-						mr.path = prefix + nameToPath(m.Name)
+						var verbs map[string]bool
+						mr.path, verbs = nm.methodPath(prefix, m.Name)
+						if len(route.Methods) == 0 {
+							mr.methods = verbs
+						}
 					}
 					if len(route.Methods) > 0 {
 						mr.methods = make(map[string]bool)
@@ -146,13 +204,17 @@ func serviceToMethods(prefix string, svc interface{}) (methods []*method) {
 						}
 					}
 					mr.mustParse()
+					mr.setRoute(route)
 					methods = append(methods, mr)
 				}
 				continue
 			}
 		}
-		mm.path = prefix + nameToPath(m.Name)
+		mm.path, mm.methods = nm.methodPath(prefix, m.Name)
 		mm.mustParse()
+		route := meta[m.Name]
+		route.Handler = m.Name
+		mm.setRoute(route)
 		methods = append(methods, mm)
 	}
 
@@ -169,6 +231,21 @@ func serviceToMethods(prefix string, svc interface{}) (methods []*method) {
 		}
 		route := f.Tag.Get("route")
 		if route != "-" {
+			// plain http.Handler fields are mounted with their path stripped
+			if hh, ok := fieldHandler(vv.Field(i)); ok {
+				if route == "" {
+					route = nm.path(f.Name)
+				}
+				mounted := mountHandler(prefix+strings.Trim(route, "/"), location+"."+f.Name, hh)
+				for _, m := range mounted {
+					m.middlewares = middlewares
+					m.writer = writer
+					m.setRoute(Route{Handler: f.Name})
+				}
+				setHost(mounted, f.Tag.Get("host"))
+				methods = append(methods, mounted...)
+				continue
+			}
 			fk := f.Type.Kind()
 			fv := vv.Field(i)
 			if fk == reflect.Ptr {
@@ -177,70 +254,81 @@ func serviceToMethods(prefix string, svc interface{}) (methods []*method) {
 			}
 			if fk == reflect.Struct && fv.IsValid() {
 				if route == "" {
-					route = nameToPath(f.Name)
+					route = nm.path(f.Name)
 				}
-				route = strings.Trim(route, "/") + "/"
+				// route:"/" mounts the struct at the parent path, handy with host tags
+				route = servicePath(route)
 				sv := fv.Addr().Interface()
-				methods = append(methods, serviceToMethods(prefix+route, sv)...)
+				nested := serviceToMethods(prefix+route, sv, nm)
+				setHost(nested, f.Tag.Get("host"))
+				if tag := f.Tag.Get("version"); tag != "" {
+					setVersion(nested, parseVersion(tag))
+				}
+				methods = append(methods, nested...)
 			}
 		}
 	}
 	methods = append(methods, funcMethods...)
+	setVersion(methods, version)
 	return
 }
 
-// Converts a Name into a path route like:
-// HelloWorld -> hello-world
-// Hello_World -> hello_world
-// Hello_0 -> hello/{0}
-// Hello_0_World -> hello/{0}/world
-func nameToPath(name string) string {
-	var buf strings.Builder
-	nt := len(name)
-	if name == "Index" {
-		return ""
+// fieldHandler returns the http.Handler of a non nil interface, pointer or
+// func field such as http.Handler, *httputil.ReverseProxy or http.HandlerFunc.
+func fieldHandler(fv reflect.Value) (http.Handler, bool) {
+	switch fv.Kind() {
+	case reflect.Interface, reflect.Ptr, reflect.Func:
+		if fv.IsNil() {
+			return nil, false
+		}
+	default:
+		return nil, false
 	}
-	if name == "Any" {
-		return "{any*}"
+	h, ok := fv.Interface().(http.Handler)
+	return h, ok
+}
+
+// handlerLocation returns the func name of a http.HandlerFunc or the type
+// of any other http.Handler.
+func handlerLocation(h http.Handler) string {
+	rv := reflect.ValueOf(h)
+	if rv.Kind() == reflect.Func {
+		return runtime.FuncForPC(rv.Pointer()).Name()
 	}
-	if strings.HasSuffix(name, "_Any") {
-		return nameToPath(strings.TrimSuffix(name, "_Any")) + "/{any*}"
+	t := rv.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
 	}
-	skipDash := false
-	startParam := false
-	for i := 0; i < nt; i++ {
-		c := rune(name[i])
-		if !startParam && unicode.IsUpper(c) {
-			if i > 0 && !skipDash {
-				buf.WriteByte('-')
-			}
-			c = unicode.ToLower(c)
-			buf.WriteRune(c)
-			skipDash = false
-		} else if c == '_' {
-			if startParam {
-				buf.WriteByte('}')
-				startParam = false
-			}
-			buf.WriteByte('/')
-			skipDash = true
-		} else {
-			if !startParam && skipDash && unicode.IsNumber(c) {
-				startParam = true
-				buf.WriteString("{")
-				buf.WriteRune(c)
-			} else {
-				buf.WriteRune(c)
-			}
-			if !startParam {
-				skipDash = false
+	return t.PkgPath() + "." + t.Name()
+}
+
+// mountHandler returns methods serving h at path and everything below it,
+// the handler gets the request with path stripped like http.StripPrefix.
+func mountHandler(path, location string, h http.Handler) []*method {
+	serve := func(rest string) func(http.ResponseWriter, *http.Request) {
+		return func(w http.ResponseWriter, r *http.Request) {
+			path := rest
+			if path == "" {
+				path = "/" + pathParam(r.Context(), "any")
 			}
+			r2 := new(http.Request)
+			*r2 = *r
+			r2.URL = new(url.URL)
+			*r2.URL = *r.URL
+			r2.URL.Path = path
+			r2.URL.RawPath = ""
+			h.ServeHTTP(w, r2)
 		}
 	}
-	if startParam {
-		buf.WriteByte('}')
+	wildcard := "{any*}"
+	if path != "" {
+		wildcard = path + "/" + wildcard
 	}
-	return buf.String()
+	exact := &method{Name: location, location: location, path: path, source: reflect.ValueOf(serve("/"))}
+	below := &method{Name: location, location: location, path: wildcard, source: reflect.ValueOf(serve(""))}
+	exact.mustParse()
+	below.mustParse()
+	return []*method{exact, below}
 }
 
 // Populates method fields, if there's no params it will leave pathRe nil and
@@ -275,3 +363,99 @@ func (m *method) mustParse() {
 		}
 	}
 }
+
+// bindPathArgs moves scalar args from the RequestReader to the path params
+// in their order of appearance, see Handler.PathArgs.
+func (m *method) bindPathArgs() {
+	var names []string
+	for _, p := range m.pathParts {
+		names = append(names, partParams(p)...)
+	}
+	var types []reflect.Type
+	var indexes []int
+	for k, i := range m.readerIndexes {
+		t := m.readerTypes[k]
+		if len(m.pathIndexes) < len(names) && isScalar(t) {
+			m.pathNames = append(m.pathNames, names[len(m.pathIndexes)])
+			m.pathIndexes = append(m.pathIndexes, i)
+			continue
+		}
+		types = append(types, t)
+		indexes = append(indexes, i)
+	}
+	m.readerTypes, m.readerIndexes = types, indexes
+}
+
+// setRoute keeps a copy of the route for metadata with Path set to the
+// resolved path of this method.
+func (m *method) setRoute(route Route) {
+	route.Path = m.path
+	m.route = &route
+	m.matcher = newRouteMatcher(route)
+}
+
+// names returns the names this method can be looked up by with Handler.URL,
+// the route name, the full location and the short Type.Method form.
+func (m *method) names() []string {
+	var names []string
+	if m.route != nil && m.route.Name != "" {
+		names = append(names, m.route.Name)
+	}
+	if m.location == "" {
+		return names
+	}
+	short := m.location
+	if idx := strings.LastIndex(short, "/"); idx != -1 {
+		short = short[idx+1:]
+	}
+	// drop package name
+	if idx := strings.Index(short, "."); idx != -1 {
+		short = short[idx+1:]
+	}
+	// funcs from runtime look like (*User).CreateUser-fm
+	short = strings.TrimSuffix(short, "-fm")
+	short = strings.NewReplacer("(*", "", "(", "", ")", "").Replace(short)
+	if short == m.location {
+		return append(names, short)
+	}
+	return append(names, m.location, short)
+}
+
+// buildPath fills the method path with the given params, every param must
+// be present and satisfy its constraint, a wildcard may be left empty.
+func (m *method) buildPath(params map[string]string) (string, error) {
+	parts := make([]string, 0, len(m.pathParts))
+	for _, p := range m.pathParts {
+		name, constraint, wildcard, ok := parseParam(p)
+		if !ok {
+			if sp := parseSegment(p); sp != nil {
+				seg, ok := sp.build(params, url.PathEscape)
+				if !ok {
+					return "", fmt.Errorf("params do not match %s", p)
+				}
+				p = seg
+			}
+			parts = append(parts, p)
+			continue
+		}
+		val, found := params[name]
+		if wildcard {
+			if val != "" {
+				segs := strings.Split(val, "/")
+				for i, seg := range segs {
+					segs[i] = url.PathEscape(seg)
+				}
+				parts = append(parts, strings.Join(segs, "/"))
+			}
+			continue
+		}
+		if !found || val == "" {
+			return "", fmt.Errorf("missing param %s", name)
+		}
+		if c := getConstraint(constraint); c != nil && !c.match(val) {
+			return "", fmt.Errorf("param %s does not match %s", name, constraint)
+		}
+		parts = append(parts, url.PathEscape(val))
+	}
+	return strings.Join(parts, "/"), nil
+}
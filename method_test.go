@@ -23,13 +23,62 @@ func TestNameToPath(t *testing.T) {
 	}
 
 	for _, v := range table {
-		p := nameToPath(v.name)
+		p := nameToPath(v.name, nil)
 		if v.path != p {
 			t.Errorf("got path %s want %s", p, v.path)
 		}
 	}
 }
 
+func TestNameMappers(t *testing.T) {
+	table := []struct {
+		name   string
+		mapper NameMapper
+		path   string
+	}{
+		{"UsersExport_0_LineItems", SnakeCase, "users_export/{0}/line_items"},
+		{"UsersExport_0_LineItems", CamelCase, "usersExport/{0}/lineItems"},
+		{"UsersExport_0_LineItems", LowerCase, "usersexport/{0}/lineitems"},
+		{"UsersExport_Any", SnakeCase, "users_export/{any*}"},
+		{"Index", SnakeCase, ""},
+		{"Any", CamelCase, "{any*}"},
+		{"UsersExport", func(s string) string { return s }, "UsersExport"},
+	}
+
+	for _, v := range table {
+		p := nameToPath(v.name, v.mapper)
+		if v.path != p {
+			t.Errorf("%s: got path %s want %s", v.name, p, v.path)
+		}
+	}
+}
+
+func TestMethodPathVerbs(t *testing.T) {
+	table := []struct {
+		name   string
+		path   string
+		method string
+	}{
+		{"GetUsers", "v1/users", "GET"},
+		{"PostUsers", "v1/users", "POST"},
+		{"PutUsers_0", "v1/users/{0}", "PUT"},
+		{"DeleteUsers_0", "v1/users/{0}", "DELETE"},
+		{"PatchUsers_0_Roles", "v1/users/{0}/roles", "PATCH"},
+		{"Get", "v1/", "GET"},
+		{"Get_0", "v1/{0}", "GET"},
+		{"Getaway", "v1/getaway", ""},
+		{"Users", "v1/users", ""},
+	}
+
+	nm := naming{verbs: true}
+	for _, v := range table {
+		p, methods := nm.methodPath("v1/", v.name)
+		if v.path != p || (v.method == "") != (methods == nil) || v.method != "" && !methods[v.method] {
+			t.Errorf("%s: got %s %v want %s %s", v.name, p, methods, v.path, v.method)
+		}
+	}
+}
+
 type serviceA struct {
 	Alpha   serviceB `route:"-"`
 	Bravo   serviceB `route:"my/{tag}"`
@@ -86,7 +135,7 @@ func TestServiceToMethods(t *testing.T) {
 		"s1/link/{0FP}":                    {},
 		"s1/link/{0FP}/{0123}":             {},
 	}
-	methods := serviceToMethods("s1/", s1)
+	methods := serviceToMethods("s1/", s1, naming{})
 	if len(methods) != len(routes) {
 		t.Fatalf("expected %d methods got %d", len(routes), len(methods))
 	}
@@ -132,3 +181,21 @@ func TestMethodMustParseMatch(t *testing.T) {
 		}
 	}
 }
+
+func TestMethodNames(t *testing.T) {
+	table := []struct {
+		location string
+		names    []string
+	}{
+		{"github.com/altlimit/restruct.serviceA.Hello", []string{"github.com/altlimit/restruct.serviceA.Hello", "serviceA.Hello"}},
+		{"github.com/altlimit/restruct.(*serviceA).Hello-fm", []string{"github.com/altlimit/restruct.(*serviceA).Hello-fm", "serviceA.Hello"}},
+		{"main.createUser", []string{"main.createUser", "createUser"}},
+		{"", nil},
+	}
+	for _, v := range table {
+		names := (&method{location: v.location}).names()
+		if !reflect.DeepEqual(names, v.names) {
+			t.Errorf("location %s want names %v got %v", v.location, v.names, names)
+		}
+	}
+}
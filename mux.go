@@ -0,0 +1,128 @@
+package restruct
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// RegisterMux registers the current routes on a Go 1.22+ http.ServeMux so
+// r.Pattern and r.PathValue work, {any*} becomes {any...}. Methods, HEAD,
+// OPTIONS and constraints are still handled by restruct with the handler's
+// Reader, Writer and middlewares. Params that aren't valid ServeMux names
+// such as {0} are registered as {_0} and r.PathValue("0") works too.
+// Services added after this aren't registered, it panics on hosts with
+// params and on routes ServeMux considers ambiguous.
+func (h *Handler) RegisterMux(mux *http.ServeMux) {
+	mc := h.routes()
+	type group struct {
+		pattern string
+		methods []*method
+	}
+	groups := make(map[string]*group)
+	var keys []string
+	for _, m := range mc.methods() {
+		pattern, key := muxPattern(mc, m)
+		g, ok := groups[key]
+		if !ok {
+			g = &group{pattern: pattern}
+			groups[key] = g
+			keys = append(keys, key)
+		}
+		g.methods = append(g.methods, m)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		g := groups[key]
+		mux.Handle(g.pattern, h.muxHandler(mc, g.methods))
+	}
+}
+
+// muxPattern returns the ServeMux pattern of a method and a key without
+// param names, routes with the same key share a pattern.
+func muxPattern(mc *methodCache, m *method) (pattern, key string) {
+	var p, k strings.Builder
+	if m.host != "" {
+		if strings.Contains(m.host, "{") {
+			panic("host " + m.host + " can't be registered on a ServeMux")
+		}
+		p.WriteString(m.host)
+		k.WriteString(m.host)
+	}
+	p.WriteString(strings.TrimSuffix(mc.prefix, "/"))
+	for _, part := range m.pathParts {
+		p.WriteByte('/')
+		k.WriteByte('/')
+		name, _, wildcard, ok := parseParam(part)
+		switch {
+		case !ok && parseSegment(part) != nil:
+			// ServeMux wildcards are whole segments, the params are set
+			// with SetPathValue
+			p.WriteString("{" + muxName(strings.Join(partParams(part), "_")) + "}")
+			k.WriteString("{}")
+		case !ok:
+			p.WriteString(part)
+			k.WriteString(part)
+		case wildcard:
+			p.WriteString("{" + muxName(name) + "...}")
+			k.WriteString("{...}")
+		default:
+			p.WriteString("{" + muxName(name) + "}")
+			k.WriteString("{}")
+		}
+	}
+	if len(m.pathParts) == 0 {
+		p.WriteString("/{$}")
+		k.WriteString("/")
+	}
+	return p.String(), k.String()
+}
+
+// muxName makes a param name a valid ServeMux wildcard name
+func muxName(name string) string {
+	b := []rune(name)
+	for i, c := range b {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 || unicode.IsDigit(b[0]) {
+		return "_" + string(b)
+	}
+	return string(b)
+}
+
+// muxHandler serves the methods sharing a ServeMux pattern, they're tried in
+// the same order as the trie so constraints and methods are respected.
+func (h *Handler) muxHandler(mc *methodCache, ms []*method) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, mc.prefix)
+		var matched []*method
+		for _, m := range ms {
+			if len(m.pathParts) == 0 {
+				if path == "" {
+					matched = append(matched, m)
+				}
+				continue
+			}
+			if _, ok := matchPath(paramCache{pathParts: m.pathParts}, path); ok {
+				matched = append(matched, m)
+			}
+		}
+		if len(matched) == 0 {
+			h.writer().Write(w, r, errNotFoundTypes, errNotFoundVals)
+			return
+		}
+		matched, status := h.candidates(matched, r)
+		m, head := matchMethod(matched, r.Method)
+		if m == nil {
+			h.noMethod(w, r, mc, matched, status)
+			return
+		}
+		for _, p := range appendParams(nil, path, m.pathParts) {
+			r.SetPathValue(p.name, p.value)
+		}
+		h.serveMethod(w, r, m, path, nil, head)
+	})
+}
@@ -0,0 +1,126 @@
+package restruct
+
+import (
+	"strings"
+	"unicode"
+)
+
+type (
+	// NameMapper converts a method or field name part such as UsersExport
+	// into a path part. Names are split by _ before mapping and the Index,
+	// Any and _0 rules always apply, see KebabCase.
+	NameMapper func(string) string
+
+	// naming controls how method and field names become paths, see
+	// Handler.VerbMethods and Handler.NameMapper
+	naming struct {
+		verbs  bool
+		mapper NameMapper
+	}
+)
+
+// HTTP verbs recognized as method name prefixes with Handler.VerbMethods
+var verbPrefixes = []string{"Get", "Post", "Put", "Patch", "Delete"}
+
+// KebabCase is the default NameMapper, UsersExport is users-export.
+func KebabCase(name string) string {
+	return splitWords(name, '-')
+}
+
+// SnakeCase maps UsersExport to users_export.
+func SnakeCase(name string) string {
+	return splitWords(name, '_')
+}
+
+// CamelCase maps UsersExport to usersExport.
+func CamelCase(name string) string {
+	for i, c := range name {
+		return string(unicode.ToLower(c)) + name[i+len(string(c)):]
+	}
+	return name
+}
+
+// LowerCase maps UsersExport to usersexport.
+func LowerCase(name string) string {
+	return strings.ToLower(name)
+}
+
+// splitWords lower cases the name and adds sep before every upper case letter
+func splitWords(name string, sep rune) string {
+	var buf strings.Builder
+	for i, c := range name {
+		if unicode.IsUpper(c) {
+			if i > 0 {
+				buf.WriteRune(sep)
+			}
+			c = unicode.ToLower(c)
+		}
+		buf.WriteRune(c)
+	}
+	return buf.String()
+}
+
+// forService returns the naming with the service NameMapper if it has one,
+// nested services inherit it.
+func (nm naming) forService(svc interface{}) naming {
+	if v, ok := svc.(Namer); ok {
+		if mapper := v.NameMapper(); mapper != nil {
+			nm.mapper = mapper
+		}
+	}
+	return nm
+}
+
+// path returns the path of a method or field name
+func (nm naming) path(name string) string {
+	return nameToPath(name, nm.mapper)
+}
+
+// methodPath returns the path of a method, with verbs GetUsers_0 is
+// users/{0} and only accepts GET.
+func (nm naming) methodPath(prefix, name string) (string, map[string]bool) {
+	if nm.verbs {
+		for _, v := range verbPrefixes {
+			rest, ok := strings.CutPrefix(name, v)
+			if !ok || rest != "" && rest[0] != '_' && !unicode.IsUpper(rune(rest[0])) {
+				continue
+			}
+			if rest == "" {
+				rest = "Index"
+			}
+			return prefix + strings.TrimPrefix(nm.path(rest), "/"), map[string]bool{strings.ToUpper(v): true}
+		}
+	}
+	return prefix + nm.path(name), nil
+}
+
+// nameToPath converts a name to a path, Index is the root, Any and _Any are
+// wildcards, _ separates parts and parts starting with a number are params.
+// Other parts are converted with mapper, KebabCase if nil, such as:
+// HelloWorld -> hello-world
+// Hello_World -> hello/world
+// Hello_0 -> hello/{0}
+// Hello_0_World -> hello/{0}/world
+func nameToPath(name string, mapper NameMapper) string {
+	if mapper == nil {
+		mapper = KebabCase
+	}
+	if name == "Index" {
+		return ""
+	}
+	if name == "Any" {
+		return "{any*}"
+	}
+	if base, ok := strings.CutSuffix(name, "_Any"); ok {
+		return nameToPath(base, mapper) + "/{any*}"
+	}
+	parts := strings.Split(name, "_")
+	for i, part := range parts {
+		if part != "" && unicode.IsNumber(rune(part[0])) {
+			parts[i] = "{" + part + "}"
+			continue
+		}
+		parts[i] = mapper(part)
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,147 @@
+package restruct
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+type (
+	// routeMatcher holds the request predicates of a Route
+	routeMatcher struct {
+		headers  map[string]string
+		query    map[string]string
+		consumes []string
+		match    func(*http.Request) bool
+	}
+)
+
+// newRouteMatcher returns nil when the route has no predicates
+func newRouteMatcher(route Route) *routeMatcher {
+	if len(route.Headers) == 0 && len(route.Query) == 0 && len(route.Consumes) == 0 && route.Match == nil {
+		return nil
+	}
+	rm := &routeMatcher{
+		query: route.Query,
+		match: route.Match,
+	}
+	if len(route.Headers) > 0 {
+		rm.headers = make(map[string]string, len(route.Headers))
+		for k, v := range route.Headers {
+			rm.headers[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+	for _, c := range route.Consumes {
+		mt, _, err := mime.ParseMediaType(c)
+		if err != nil {
+			panic("invalid Consumes media type " + c + ": " + err.Error())
+		}
+		rm.consumes = append(rm.consumes, mt)
+	}
+	return rm
+}
+
+// status returns 0 when the request matches, 415 when only the content type
+// doesn't match or 404 otherwise.
+func (rm *routeMatcher) status(r *http.Request) int {
+	for k, v := range rm.headers {
+		vals, ok := r.Header[k]
+		if !ok || v != "" && !hasValue(vals, v) {
+			return http.StatusNotFound
+		}
+	}
+	if len(rm.query) > 0 {
+		q := r.URL.Query()
+		for k, v := range rm.query {
+			vals, ok := q[k]
+			if !ok || v != "" && !hasValue(vals, v) {
+				return http.StatusNotFound
+			}
+		}
+	}
+	if rm.match != nil && !rm.match(r) {
+		return http.StatusNotFound
+	}
+	if len(rm.consumes) > 0 && !rm.consumesType(r.Header.Get("Content-Type")) {
+		return http.StatusUnsupportedMediaType
+	}
+	return 0
+}
+
+// consumesType matches a content type against Consumes, type/* is allowed
+func (rm *routeMatcher) consumesType(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, c := range rm.consumes {
+		if c == mt || c == "*/*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(c, "/*"); ok && strings.HasPrefix(mt, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func hasValue(vals []string, v string) bool {
+	for _, val := range vals {
+		if val == v {
+			return true
+		}
+	}
+	return false
+}
+
+// addMethod adds a method keeping the ones with predicates first, so a
+// route without predicates at the same path acts as the fallback, then
+// newer versions first. Others keep their registration order.
+func addMethod(ms []*method, m *method) []*method {
+	idx := len(ms)
+	for i, v := range ms {
+		if m.matcher != nil && v.matcher == nil ||
+			(m.matcher != nil) == (v.matcher != nil) && m.version > v.version {
+			idx = i
+			break
+		}
+	}
+	ms = append(ms, nil)
+	copy(ms[idx+1:], ms[idx:])
+	ms[idx] = m
+	return ms
+}
+
+// matchRoutes returns the methods whose predicates accept the request. status
+// is 415 when a method for the request method only failed on its content
+// type, 404 when no method is left and 0 otherwise. Predicates are skipped
+// for OPTIONS so CORS preflights still get an answer.
+func matchRoutes(ms []*method, r *http.Request) ([]*method, int) {
+	// methods with predicates come first, see addMethod
+	if len(ms) == 0 || ms[0].matcher == nil || r.Method == http.MethodOptions {
+		return ms, 0
+	}
+	var out []*method
+	status := 0
+	for i, m := range ms {
+		if m.matcher == nil {
+			out = append(out, ms[i:]...)
+			break
+		}
+		s := m.matcher.status(r)
+		if s == 0 {
+			out = append(out, m)
+		} else if s == http.StatusUnsupportedMediaType && m.accepts(r.Method) {
+			status = s
+		}
+	}
+	if len(out) == 0 && status == 0 {
+		status = http.StatusNotFound
+	}
+	return out, status
+}
+
+// accepts reports whether the method serves the request method
+func (m *method) accepts(reqMethod string) bool {
+	return m.methods == nil || m.methods[reqMethod] || reqMethod == http.MethodHead && m.methods[http.MethodGet]
+}
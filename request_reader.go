@@ -17,9 +17,11 @@ type (
 
 	// DefaultReader processes request with json.Encoder, urlencoded form and multipart for structs
 	// if it's just basic types it will be read from body as array such as [1, "hello", false]
-	// you can overwrite bind to apply validation library, etc
+	// you can overwrite bind to apply validation library, etc. Structs are
+	// checked with Validate after binding unless SkipValidation is set.
 	DefaultReader struct {
-		Bind func(*http.Request, interface{}, ...string) error
+		Bind           func(*http.Request, interface{}, ...string) error
+		SkipValidation bool
 	}
 )
 
@@ -50,6 +52,9 @@ func (dr *DefaultReader) Read(r *http.Request, types []reflect.Type) (vals []ref
 			if err != nil {
 				return
 			}
+			if err = dr.validate(val); err != nil {
+				return
+			}
 			if !ptr {
 				val = val.Elem()
 			}
@@ -86,7 +91,25 @@ func (dr *DefaultReader) Read(r *http.Request, types []reflect.Type) (vals []ref
 			badRequest("DefaultReader.Read: param %d must be %s (%v)", i, t, unmarshalErr)
 			return
 		}
+		if err = dr.validate(val); err != nil {
+			return
+		}
 		vals[i] = val.Elem()
 	}
 	return
 }
+
+// validate runs Validate on struct values
+func (dr *DefaultReader) validate(val reflect.Value) error {
+	if dr.SkipValidation {
+		return nil
+	}
+	t := val.Type()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	return Validate(val.Interface())
+}
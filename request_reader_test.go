@@ -2,12 +2,15 @@ package restruct_test
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/altlimit/restruct"
 )
@@ -170,3 +173,202 @@ func TestDefaultReaderMapSlice(t *testing.T) {
 	}
 }
 
+
+type (
+	signupAddress struct {
+		City string `json:"city" validate:"required"`
+	}
+
+	signupRequest struct {
+		Name    string          `json:"name" validate:"required,min=3,max=10"`
+		Email   string          `json:"email" validate:"required,email"`
+		Role    string          `json:"role" validate:"omitempty,oneof=admin user"`
+		Age     int             `json:"age" validate:"min=18"`
+		Code    string          `json:"code" validate:"omitempty,regex=^[a-z]+$"`
+		Slug    string          `json:"slug" validate:"omitempty,slug"`
+		Tags    []string        `json:"tags" validate:"max=2"`
+		Home    *signupAddress  `json:"home"`
+		Others  []signupAddress `json:"others"`
+		Page    int             `query:"page" json:"-" validate:"omitempty,max=100"`
+		Ignored string          `json:"-"`
+	}
+
+	signupService struct{}
+)
+
+func (s *signupService) Signup(req signupRequest) string {
+	return req.Name
+}
+
+func TestValidation(t *testing.T) {
+	restruct.RegisterRule("slug", func(v reflect.Value, _ string) bool {
+		return !strings.ContainsAny(v.String(), " _")
+	})
+	h := restruct.NewHandler(&signupService{})
+	valid := `"name":"bob","email":"bob@example.com","age":20`
+	tests := []struct {
+		path     string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{"/signup", `{` + valid + `}`, 200, `"bob"`},
+		{"/signup", `{}`, 400, `{"data":{"age":"min","email":"required","name":"required"},"error":"validation error"}`},
+		{"/signup", `{"name":"bo","email":"bob","age":20}`, 400, `{"data":{"email":"email","name":"min"},"error":"validation error"}`},
+		{"/signup", `{` + valid + `,"role":"root","code":"A1","slug":"a b","tags":["a","b","c"]}`, 400, `{"data":{"code":"regex","role":"oneof","slug":"slug","tags":"max"},"error":"validation error"}`},
+		{"/signup", `{` + valid + `,"role":"admin","code":"abc","slug":"a-b"}`, 200, `"bob"`},
+		{"/signup", `{` + valid + `,"home":{},"others":[{"city":"x"},{}]}`, 400, `{"data":{"home.city":"required","others[1].city":"required"},"error":"validation error"}`},
+		{"/signup?page=101", `{` + valid + `}`, 400, `{"data":{"page":"max"},"error":"validation error"}`},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		body := strings.TrimRight(w.Body.String(), "\n")
+		if w.Code != tc.wantCode || body != tc.wantBody {
+			t.Errorf("%s %s: want %d %s got %d %s", tc.path, tc.body, tc.wantCode, tc.wantBody, w.Code, body)
+		}
+	}
+
+	h.Reader = &restruct.DefaultReader{Bind: restruct.Bind, SkipValidation: true}
+	req := httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Errorf("SkipValidation: want 200 got %d %s", w.Code, w.Body.String())
+	}
+}
+
+type unknownRuleService struct{}
+
+func (s *unknownRuleService) Init(h *restruct.Handler) {
+	h.Strict = true
+}
+
+func (s *unknownRuleService) Save(req struct {
+	Age int `json:"age" validate:"gte=1"`
+}) {
+}
+
+func TestValidationUnknownRule(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "Age: gte") {
+			t.Errorf("want unknown rule panic got %v", r)
+		}
+	}()
+	restruct.NewHandler(&unknownRuleService{})
+}
+
+type lateRuleService struct{}
+
+func (s *lateRuleService) Save(req struct {
+	Count int `json:"count" validate:"even"`
+}) {
+}
+
+func TestValidationLateRule(t *testing.T) {
+	h := restruct.NewHandler(&lateRuleService{})
+	save := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/save", strings.NewReader(`{"count":3}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := save(); code != 200 {
+		t.Errorf("unknown rule: want 200 got %d", code)
+	}
+	restruct.RegisterRule("even", func(v reflect.Value, _ string) bool {
+		return v.Int()%2 == 0
+	})
+	if code := save(); code != 400 {
+		t.Errorf("rule registered after NewHandler: want 400 got %d", code)
+	}
+}
+
+type (
+	listFilter struct {
+		Status string `query:"status" json:"status" default:"open"`
+	}
+
+	listRequest struct {
+		Page    int           `query:"page" json:"page" default:"1"`
+		Limit   *int          `query:"limit" json:"limit" default:"20"`
+		Sort    []string      `query:"sort" json:"sort" default:"name,id"`
+		Timeout time.Duration `query:"timeout" json:"timeout" default:"5s"`
+		Filter  listFilter    `query:"filter" json:"filter"`
+		Until   int           `query:"until" json:"until"`
+	}
+
+	listService struct{}
+)
+
+func (r *listRequest) SetDefaults() {
+	if r.Until == 0 {
+		r.Until = r.Page + 10
+	}
+}
+
+func (s *listService) List(req listRequest) string {
+	return fmt.Sprintf("%d %d %v %s %s %d", req.Page, *req.Limit, req.Sort, req.Timeout, req.Filter.Status, req.Until)
+}
+
+type invalidDefaultService struct {
+	strict bool
+}
+
+func (s *invalidDefaultService) Init(h *restruct.Handler) {
+	h.Strict = s.strict
+}
+
+func (s *invalidDefaultService) Count(req struct {
+	Page int `query:"page" default:"abc"`
+}) int {
+	return req.Page
+}
+
+func TestInvalidDefaults(t *testing.T) {
+	h := restruct.NewHandler(&invalidDefaultService{})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/count", nil))
+	if body := strings.TrimRight(w.Body.String(), "\n"); w.Code != 200 || body != "0" {
+		t.Errorf("want invalid default skipped got %d %s", w.Code, body)
+	}
+
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "Page: abc") {
+			t.Errorf("want invalid default panic got %v", r)
+		}
+	}()
+	restruct.NewHandler(&invalidDefaultService{strict: true})
+}
+
+func TestBindDefaults(t *testing.T) {
+	h := restruct.NewHandler(&listService{})
+	tests := []struct {
+		method   string
+		path     string
+		body     string
+		wantBody string
+	}{
+		{http.MethodGet, "/list", "", `"1 20 [name id] 5s open 11"`},
+		{http.MethodGet, "/list?page=0&limit=0&sort=age&timeout=1m&filter.status=closed&until=3", "", `"0 0 [age] 1m0s closed 3"`},
+		{http.MethodGet, "/list?page=", "", `"1 20 [name id] 5s open 11"`},
+		{http.MethodPost, "/list", `{"page":0,"filter":{}}`, `"0 20 [name id] 5s open 10"`},
+		{http.MethodPost, "/list", `{"page":2,"limit":5,"filter":{"status":""}}`, `"2 5 [name id] 5s  12"`},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		if tc.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		body := strings.TrimRight(w.Body.String(), "\n")
+		if w.Code != 200 || body != tc.wantBody {
+			t.Errorf("%s %s %s: want %s got %d %s", tc.method, tc.path, tc.body, tc.wantBody, w.Code, body)
+		}
+	}
+}
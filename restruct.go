@@ -11,5 +11,5 @@ func Handle(pattern string, svc interface{}) {
 		h = NewHandler(svc)
 	}
 	h.mustCompile(pattern)
-	http.Handle(h.prefix, h)
+	http.Handle(h.routes().prefix, h)
 }
@@ -0,0 +1,180 @@
+package restruct
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+type (
+	// RouteInfo describes a registered route, see Handler.RouteInfos.
+	RouteInfo struct {
+		// Host is the host pattern, empty means any host
+		Host string
+		// Path is the full path including the handler prefix
+		Path string
+		// PathParts are the path segments without the handler prefix
+		PathParts []string
+		// Params are the path param names in order
+		Params []string
+		// Methods are the allowed HTTP methods, empty means all
+		Methods []string
+		// Location is the Go location of the handler method or func
+		Location string
+		// ParamTypes are the handler arguments
+		ParamTypes []reflect.Type
+		// ReturnTypes are the handler returns
+		ReturnTypes []reflect.Type
+		// Middlewares is the number of global, service and route middlewares
+		Middlewares int
+		// View is true for routes registered from files of a View
+		View bool
+		// Version is the API version of the service, 0 if not versioned
+		Version int
+
+		// Route metadata, see Route
+		Name        string
+		Summary     string
+		Description string
+		Tags        []string
+		Deprecated  bool
+		Meta        map[string]any
+	}
+)
+
+var routesTemplate = template.Must(template.New("routes").Parse(`<!DOCTYPE html>
+<html><head><title>Routes</title>
+<style>body{font-family:sans-serif}table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:4px 8px;text-align:left;font-family:monospace}</style>
+</head><body><table>
+<tr><th>Path</th><th>Methods</th><th>Location</th><th>Params</th><th>Returns</th><th>Middlewares</th><th>View</th><th>Summary</th></tr>
+{{range .}}<tr><td>{{.Host}}{{.Path}}</td><td>{{range .Methods}}{{.}} {{else}}*{{end}}</td><td>{{.Location}}</td><td>{{range .ParamTypes}}{{.}}<br>{{end}}</td><td>{{range .ReturnTypes}}{{.}}<br>{{end}}</td><td>{{.Middlewares}}</td><td>{{.View}}</td><td>{{if .Deprecated}}<s>{{.Summary}}</s> (deprecated){{else}}{{.Summary}}{{end}}</td></tr>
+{{end}}</table></body></html>`))
+
+// String returns the route as host/path [METHODS] -> location(params) (returns)
+func (ri RouteInfo) String() string {
+	methods := "*"
+	if len(ri.Methods) > 0 {
+		methods = strings.Join(ri.Methods, ",")
+	}
+	r := ri.Host + ri.Path + " [" + methods + "] -> " + ri.Location
+	r += "(" + strings.Join(typeNames(ri.ParamTypes), ", ") + ")"
+	if len(ri.ReturnTypes) > 0 {
+		r += " (" + strings.Join(typeNames(ri.ReturnTypes), ", ") + ")"
+	}
+	return r
+}
+
+// MarshalJSON writes types by name since reflect.Type has no json form
+func (ri RouteInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Host        string         `json:"host,omitempty"`
+		Path        string         `json:"path"`
+		PathParts   []string       `json:"pathParts"`
+		Params      []string       `json:"params"`
+		Methods     []string       `json:"methods"`
+		Location    string         `json:"location"`
+		ParamTypes  []string       `json:"paramTypes"`
+		ReturnTypes []string       `json:"returnTypes"`
+		Middlewares int            `json:"middlewares"`
+		View        bool           `json:"view"`
+		Version     int            `json:"version,omitempty"`
+		Name        string         `json:"name,omitempty"`
+		Summary     string         `json:"summary,omitempty"`
+		Description string         `json:"description,omitempty"`
+		Tags        []string       `json:"tags,omitempty"`
+		Deprecated  bool           `json:"deprecated,omitempty"`
+		Meta        map[string]any `json:"meta,omitempty"`
+	}{
+		Host:        ri.Host,
+		Path:        ri.Path,
+		PathParts:   ri.PathParts,
+		Params:      ri.Params,
+		Methods:     ri.Methods,
+		Location:    ri.Location,
+		ParamTypes:  typeNames(ri.ParamTypes),
+		ReturnTypes: typeNames(ri.ReturnTypes),
+		Middlewares: ri.Middlewares,
+		View:        ri.View,
+		Version:     ri.Version,
+		Name:        ri.Name,
+		Summary:     ri.Summary,
+		Description: ri.Description,
+		Tags:        ri.Tags,
+		Deprecated:  ri.Deprecated,
+		Meta:        ri.Meta,
+	})
+}
+
+// RouteInfos returns all registered routes sorted the same way as Routes.
+func (h *Handler) RouteInfos() []RouteInfo {
+	mc := h.routes()
+	methods := mc.methods()
+	infos := make([]RouteInfo, 0, len(methods))
+	for _, m := range methods {
+		ri := RouteInfo{
+			Host:        m.host,
+			Path:        mc.prefix + m.path,
+			PathParts:   m.pathParts,
+			Location:    m.location,
+			ParamTypes:  m.params,
+			ReturnTypes: m.returns,
+			Middlewares: mc.middlewares + len(m.middlewares),
+			View:        m.view,
+			Version:     m.version,
+		}
+		if m.route != nil {
+			ri.Name = m.route.Name
+			ri.Summary = m.route.Summary
+			ri.Description = m.route.Description
+			ri.Tags = m.route.Tags
+			ri.Deprecated = m.route.Deprecated
+			ri.Meta = m.route.Meta
+		}
+		for _, p := range m.pathParts {
+			ri.Params = append(ri.Params, partParams(p)...)
+		}
+		for k := range m.methods {
+			ri.Methods = append(ri.Methods, k)
+		}
+		sort.Strings(ri.Methods)
+		infos = append(infos, ri)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].String() < infos[j].String()
+	})
+	return infos
+}
+
+// RoutesHandler returns a debug endpoint listing all routes, it writes json
+// unless the request accepts text/html. Mount it wherever you like:
+// mux.Handle("/debug/routes", h.RoutesHandler())
+func (h *Handler) RoutesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		infos := h.RouteInfos()
+		if strings.Contains(r.Header.Get("Accept"), "text/html") {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			if err := routesTemplate.Execute(w, infos); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		b, err := json.Marshal(infos)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Write(b)
+	})
+}
+
+func typeNames(types []reflect.Type) []string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = t.String()
+	}
+	return names
+}
@@ -1,5 +1,7 @@
 package restruct
 
+import "net/http"
+
 type (
 	// Router can be used to override method name to specific path,
 	// implement Router interface in your service and return a slice of Route:
@@ -18,11 +20,26 @@ type (
 		Init(*Handler)
 	}
 
+	// Namer interface to map the method and field names of a service and
+	// its nested services with another NameMapper such as SnakeCase
+	Namer interface {
+		NameMapper() NameMapper
+	}
+
+	// Metadata interface to describe methods found by naming convention,
+	// return a map of method name to a Route with only metadata fields set.
+	// Routes from the Router interface carry their own metadata.
+	Metadata interface {
+		Metadata() map[string]Route
+	}
+
 	// Route for doing overrides with router interface and method restrictions.
 	Route struct {
 		// Handler is the method name (string) or a func to use for this route.
 		// If string, it maps to the struct method by name.
 		// If func, it is used directly as the handler.
+		// Use Func or Action for typed funcs that skip reflect.Call.
+		// An http.Handler is mounted at Path and everything below it.
 		Handler any
 		// optional path, will use default behaviour if not present
 		Path string
@@ -30,5 +47,38 @@ type (
 		Methods []string
 		// optional middlewares, run specific middleware for this route
 		Middlewares []Middleware
+
+		// optional predicates, routes at the same path are tried with the
+		// ones having predicates first. Headers and Query values must match,
+		// an empty value only requires the key.
+		Headers map[string]string
+		Query   map[string]string
+		// optional content types of the body such as application/json or image/*,
+		// a 415 is returned when nothing else matches
+		Consumes []string
+		// optional custom predicate
+		Match func(*http.Request) bool
+
+		// optional name, can be used with Handler.URL
+		Name string
+		// optional summary and description for docs
+		Summary     string
+		Description string
+		// optional tags, e.g. to group docs or apply auth by tag in middleware
+		Tags []string
+		// optional deprecation flag, e.g. to emit Deprecation headers in middleware
+		Deprecated bool
+		// optional arbitrary metadata
+		Meta map[string]any
 	}
 )
+
+// HasTag reports whether the route has the given tag
+func (r *Route) HasTag(tag string) bool {
+	for _, t := range r.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package restruct
+
+import (
+	"strings"
+	"sync"
+)
+
+type (
+	// segmentPattern is a path part mixing static text and params such as
+	// {name}.{ext}, v{version} or @{username}
+	segmentPattern struct {
+		raw    string
+		tokens []segmentToken
+		static int // length of static text, longer is tried first
+	}
+
+	segmentToken struct {
+		text       string // static text or param name
+		param      bool
+		constraint *paramConstraint
+	}
+)
+
+// parsed segments by raw part, nil for parts without partial params
+var segmentCache sync.Map
+
+// parseSegment returns the pattern of a part with params inside it, it
+// returns nil for static parts and parts that are a single param. It panics
+// on unbalanced braces, wildcards and params that aren't separated by text.
+func parseSegment(part string) *segmentPattern {
+	if !strings.Contains(part, "{") {
+		return nil
+	}
+	if _, _, _, ok := parseParam(part); ok {
+		return nil
+	}
+	if sp, ok := segmentCache.Load(part); ok {
+		return sp.(*segmentPattern)
+	}
+	sp := &segmentPattern{raw: part}
+	start, depth := 0, 0
+	for i := 0; i < len(part); i++ {
+		switch part[i] {
+		case '{':
+			if depth == 0 {
+				if i > start {
+					sp.tokens = append(sp.tokens, segmentToken{text: part[start:i]})
+					sp.static += i - start
+				} else if i > 0 {
+					panic("path part " + part + " needs static text between params")
+				}
+				start = i
+			}
+			depth++
+		case '}':
+			depth--
+			if depth < 0 {
+				panic("invalid path part " + part)
+			}
+			if depth == 0 {
+				name, constraint, wildcard, _ := parseParam(part[start : i+1])
+				if wildcard {
+					panic("path part " + part + " can't have a wildcard param")
+				}
+				sp.tokens = append(sp.tokens, segmentToken{
+					text:       name,
+					param:      true,
+					constraint: getConstraint(constraint),
+				})
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		panic("invalid path part " + part)
+	}
+	if start < len(part) {
+		sp.tokens = append(sp.tokens, segmentToken{text: part[start:]})
+		sp.static += len(part) - start
+	}
+	segmentCache.Store(part, sp)
+	return sp
+}
+
+// partParams returns the param names of a path part in order
+func partParams(part string) []string {
+	if name, _, _, ok := parseParam(part); ok {
+		return []string{name}
+	}
+	sp := parseSegment(part)
+	if sp == nil {
+		return nil
+	}
+	var names []string
+	for _, t := range sp.tokens {
+		if t.param {
+			names = append(names, t.text)
+		}
+	}
+	return names
+}
+
+// match reports whether the segment matches and adds its params if params
+// isn't nil. Params take at least one character and are greedy, so
+// {name}.{ext} matches archive.tar.gz with name archive.tar and ext gz.
+func (sp *segmentPattern) match(s string, params map[string]string) bool {
+	return sp.matchFrom(0, s, params)
+}
+
+func (sp *segmentPattern) matchFrom(i int, s string, params map[string]string) bool {
+	if i == len(sp.tokens) {
+		return s == ""
+	}
+	t := sp.tokens[i]
+	if !t.param {
+		rest, ok := strings.CutPrefix(s, t.text)
+		return ok && sp.matchFrom(i+1, rest, params)
+	}
+	last := i == len(sp.tokens)-1
+	for end := len(s); end > 0; end-- {
+		if last && end != len(s) {
+			break
+		}
+		if !last && !strings.HasPrefix(s[end:], sp.tokens[i+1].text) {
+			continue
+		}
+		val := s[:end]
+		if t.constraint != nil && !t.constraint.match(val) {
+			continue
+		}
+		if sp.matchFrom(i+1, s[end:], params) {
+			if params != nil {
+				params[t.text] = val
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// build fills the params of the segment, ok is false if a param is missing
+// or the path wouldn't match back to the same values.
+func (sp *segmentPattern) build(params map[string]string, escape func(string) string) (string, bool) {
+	var raw, escaped strings.Builder
+	for _, t := range sp.tokens {
+		if !t.param {
+			raw.WriteString(t.text)
+			escaped.WriteString(t.text)
+			continue
+		}
+		val := params[t.text]
+		if val == "" {
+			return "", false
+		}
+		raw.WriteString(val)
+		escaped.WriteString(escape(val))
+	}
+	// the values must come back the same when the path is matched
+	matched := make(map[string]string)
+	if !sp.match(raw.String(), matched) {
+		return "", false
+	}
+	for name, val := range matched {
+		if params[name] != val {
+			return "", false
+		}
+	}
+	return escaped.String(), true
+}
+
+// shape returns the segment with param names dropped, see routeShape
+func (sp *segmentPattern) shape() string {
+	var b strings.Builder
+	for _, t := range sp.tokens {
+		if !t.param {
+			b.WriteString(t.text)
+			continue
+		}
+		b.WriteString("{:")
+		if t.constraint != nil {
+			b.WriteString(t.constraint.raw)
+		}
+		b.WriteString("}")
+	}
+	return b.String()
+}
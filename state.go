@@ -0,0 +1,117 @@
+package restruct
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+type (
+	// routeParam is a path or host param of the matched route
+	routeParam struct {
+		name  string
+		value string
+	}
+
+	// requestState is the routing state of a request stored under keyState.
+	// It's not reused as the request context can outlive the handler.
+	requestState struct {
+		params  []routeParam
+		route   *Route
+		isAny   bool
+		version int
+		once    sync.Once
+		vars    map[string]string // built by Vars on first use
+		buf     [4]routeParam     // backs params so most routes allocate once
+	}
+)
+
+// newRequestState returns a state with params backed by its own buffer
+func newRequestState() *requestState {
+	st := &requestState{}
+	st.params = st.buf[:0]
+	return st
+}
+
+// getState returns the routing state of the context, nil if there's none
+func getState(ctx context.Context) *requestState {
+	st, _ := ctx.Value(keyState).(*requestState)
+	return st
+}
+
+// param returns a param by name, the last one wins like in a map
+func (st *requestState) param(name string) (string, bool) {
+	for i := len(st.params) - 1; i >= 0; i-- {
+		if st.params[i].name == name {
+			return st.params[i].value, true
+		}
+	}
+	return "", false
+}
+
+// addParam adds a param unless there's already one with the same name
+func (st *requestState) addParam(name, value string) {
+	if _, ok := st.param(name); !ok {
+		st.params = append(st.params, routeParam{name: name, value: value})
+	}
+}
+
+// varsMap returns the params as a map, it's built once per request
+func (st *requestState) varsMap() map[string]string {
+	st.once.Do(func() {
+		st.vars = make(map[string]string, len(st.params))
+		for _, p := range st.params {
+			st.vars[p.name] = p.value
+		}
+	})
+	return st.vars
+}
+
+// pathParam returns a route param from the context, empty if not set
+func pathParam(ctx context.Context, name string) string {
+	if st := getState(ctx); st != nil {
+		v, _ := st.param(name)
+		return v
+	}
+	return ""
+}
+
+// appendParams appends the params of urlPath matched by pathParts
+func appendParams(dst []routeParam, urlPath string, pathParts []string) []routeParam {
+	for _, part := range pathParts {
+		if urlPath == "" {
+			// a wildcard still matches an empty rest
+			if name, _, wildcard, ok := parseParam(part); ok && wildcard {
+				dst = append(dst, routeParam{name: name})
+			}
+			break
+		}
+		var segment string
+		if idx := strings.IndexByte(urlPath, '/'); idx == -1 {
+			segment, urlPath = urlPath, ""
+		} else {
+			segment, urlPath = urlPath[:idx], urlPath[idx+1:]
+		}
+		if strings.IndexByte(part, '{') == -1 {
+			continue
+		}
+		if name, _, wildcard, ok := parseParam(part); ok {
+			if wildcard {
+				if urlPath != "" {
+					segment += "/" + urlPath
+				}
+				return append(dst, routeParam{name: name, value: segment})
+			}
+			dst = append(dst, routeParam{name: name, value: segment})
+		} else if sp := parseSegment(part); sp != nil {
+			vals := make(map[string]string, len(sp.tokens))
+			sp.match(segment, vals)
+			for _, t := range sp.tokens {
+				if t.param {
+					dst = append(dst, routeParam{name: t.text, value: vals[t.text]})
+				}
+			}
+		}
+	}
+	return dst
+}
@@ -19,6 +19,8 @@ type StructField struct {
 	Tag   string
 	Index int
 	Tags  map[string]string
+	// Keys are the keys of Tags in the order of the tag
+	Keys []string
 }
 
 func (sf *StructField) Value(tag string) (v string, ok bool) {
@@ -69,13 +71,21 @@ func NewStructField(index int, tag string) *StructField {
 		if sf.Tag == "" {
 			sf.Tag = key
 		}
+		if _, ok := sf.Tags[key]; !ok {
+			sf.Keys = append(sf.Keys, key)
+		}
 		sf.Tags[key] = val
 	}
 	return sf
 }
 
 func GetFieldsByTag(i interface{}, tag string) []*StructField {
-	t := reflect.TypeOf(i)
+	return GetFieldsByType(reflect.TypeOf(i), tag)
+}
+
+// GetFieldsByType is GetFieldsByTag for a struct type or a pointer to one,
+// it's useful for nested structs that don't have a value yet.
+func GetFieldsByType(t reflect.Type, tag string) []*StructField {
 	if t.Kind() == reflect.Ptr {
 		t = t.Elem()
 	}
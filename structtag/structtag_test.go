@@ -59,4 +59,18 @@ func TestGetFieldsByTag(t *testing.T) {
 			}
 		}
 	}
+	byType := GetFieldsByType(reflect.TypeOf(hello{}), "marshal")
+	if len(byType) != 3 || byType[0] != GetFieldsByTag(h, "marshal")[0] {
+		t.Errorf("wanted cached fields by type got %v", byType)
+	}
+}
+
+func TestStructFieldKeys(t *testing.T) {
+	sf := NewStructField(1, "required, min=3,oneof=a b,min=4")
+	if !reflect.DeepEqual(sf.Keys, []string{"required", "min", "oneof"}) {
+		t.Errorf("wanted keys in order got %v", sf.Keys)
+	}
+	if sf.Tags["min"] != "4" || sf.Tags["oneof"] != "a b" {
+		t.Errorf("wanted min=4 oneof=a b got %v", sf.Tags)
+	}
 }
@@ -0,0 +1,73 @@
+package restruct
+
+import (
+	"context"
+	"reflect"
+	"sync"
+)
+
+type (
+	// TypedFunc is a Route.Handler created with Func or Action, it's called
+	// directly instead of with reflection while the input still goes through
+	// the RequestReader and the output through the ResponseWriter.
+	TypedFunc struct {
+		fn     any
+		invoke invoker
+	}
+
+	// invoker calls a handler with its args and returns its results
+	invoker func(args []reflect.Value) []reflect.Value
+)
+
+// Func wraps a typed handler for Route.Handler, In is read with the
+// RequestReader (or from path params if it's a scalar) and Out is written
+// with the ResponseWriter.
+//
+//	{Path: "users/{id}", Handler: restruct.Func(func(ctx context.Context, id int64) (*User, error) {...})}
+func Func[In, Out any](fn func(context.Context, In) (Out, error)) TypedFunc {
+	return TypedFunc{fn: fn, invoke: func(args []reflect.Value) []reflect.Value {
+		ctx, _ := args[0].Interface().(context.Context)
+		in, _ := args[1].Interface().(In)
+		out, err := fn(ctx, in)
+		return []reflect.Value{reflect.ValueOf(&out).Elem(), reflect.ValueOf(&err).Elem()}
+	}}
+}
+
+// Action is a Func without output, it writes nothing on success.
+func Action[In any](fn func(context.Context, In) error) TypedFunc {
+	return TypedFunc{fn: fn, invoke: func(args []reflect.Value) []reflect.Value {
+		ctx, _ := args[0].Interface().(context.Context)
+		in, _ := args[1].Interface().(In)
+		err := fn(ctx, in)
+		return []reflect.Value{reflect.ValueOf(&err).Elem()}
+	}}
+}
+
+// invokers registered by generated code, keyed by receiver type and method
+var invokers sync.Map
+
+type invokerKey struct {
+	recv   reflect.Type
+	method string
+}
+
+// RegisterInvoker registers a typed invoker for a service method so it's
+// called without reflect.Call. It's meant for code generated by
+// cmd/restructgen in an init func, register before creating handlers.
+func RegisterInvoker[T any](method string, fn func(recv T, args []reflect.Value) []reflect.Value) {
+	invokers.Store(invokerKey{recv: reflect.TypeFor[T](), method: method}, func(recv any, args []reflect.Value) []reflect.Value {
+		return fn(recv.(T), args)
+	})
+}
+
+// lookupInvoker returns the registered invoker of a method bound to svc
+func lookupInvoker(t reflect.Type, method string, svc any) invoker {
+	fn, ok := invokers.Load(invokerKey{recv: t, method: method})
+	if !ok {
+		return nil
+	}
+	call := fn.(func(any, []reflect.Value) []reflect.Value)
+	return func(args []reflect.Value) []reflect.Value {
+		return call(svc, args)
+	}
+}
@@ -2,6 +2,7 @@ package restruct
 
 import (
 	"context"
+	"encoding"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,6 +11,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/altlimit/restruct/structtag"
 )
@@ -17,10 +19,8 @@ import (
 var (
 	MaxBodySize int64 = 10485760 // 10MB default limit
 
-	// Pre-cached slice types for BindQuery
-	intSlice    = reflect.TypeOf([]int{})
-	int64Slice  = reflect.TypeOf([]int64{})
-	stringSlice = reflect.TypeOf([]string{})
+	typeDuration        = reflect.TypeOf(time.Duration(0))
+	typeTextUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
 )
 
 // Params returns map of params from url path like /{param1} will be map[param1] = value
@@ -28,18 +28,35 @@ func Params(r *http.Request) map[string]string {
 	return Vars(r.Context())
 }
 
-// Vars returns map of params from url from request context
+// Vars returns map of params from url from request context.
 func Vars(ctx context.Context) map[string]string {
-	if params, ok := ctx.Value(keyParams).(map[string]string); ok {
-		return params
+	if st := getState(ctx); st != nil {
+		return st.varsMap()
 	}
 	return map[string]string{}
 }
 
+// GetRoute returns the matched route with its metadata from the request context,
+// Path is the route pattern without the handler prefix. It must not be modified.
+func GetRoute(ctx context.Context) *Route {
+	if st := getState(ctx); st != nil {
+		return st.route
+	}
+	return nil
+}
+
 // SetVars returns a new context with the given route params set.
 // Useful for testing handlers that read route parameters via Vars.
 func SetVars(ctx context.Context, params map[string]string) context.Context {
-	return context.WithValue(ctx, keyParams, params)
+	st := &requestState{params: make([]routeParam, 0, len(params))}
+	if cur := getState(ctx); cur != nil {
+		st.route, st.isAny, st.version = cur.route, cur.isAny, cur.version
+	}
+	for k, v := range params {
+		st.params = append(st.params, routeParam{name: k, value: v})
+	}
+	st.once.Do(func() { st.vars = params })
+	return context.WithValue(ctx, keyState, st)
 }
 
 // SetParams returns a new request with the given route params set.
@@ -53,7 +70,9 @@ func Query(r *http.Request, name string) string {
 	return r.URL.Query().Get(name)
 }
 
-// Bind checks for valid methods and tries to bind query strings and body into struct
+// Bind checks for valid methods and tries to bind path params, headers,
+// cookies, query strings and body into struct. Fields with a default tag
+// keep their default when no source has them, then Defaulter is called.
 func Bind(r *http.Request, out interface{}, methods ...string) error {
 	if len(methods) > 0 {
 		found := false
@@ -70,15 +89,41 @@ func Bind(r *http.Request, out interface{}, methods ...string) error {
 	if out == nil {
 		return nil
 	}
+	// defaults are set first so any source overrides them
+	SetDefaults(out)
+	if err := BindPath(r, out); err != nil {
+		return err
+	}
+	if err := BindHeader(r, out); err != nil {
+		return err
+	}
+	if err := BindCookie(r, out); err != nil {
+		return err
+	}
 	if len(r.URL.Query()) > 0 {
 		if err := BindQuery(r, out); err != nil {
 			return err
 		}
 	}
+	if err := bindBody(r, out); err != nil {
+		return err
+	}
+	if d, ok := out.(Defaulter); ok {
+		d.SetDefaults()
+	}
+	return nil
+}
+
+// bindBody binds the body by content type, GET requests and empty bodies
+// without a content type such as DELETE /items/5 are skipped.
+func bindBody(r *http.Request, out interface{}) error {
 	if r.Method == http.MethodGet {
 		return nil
 	}
 	cType := r.Header.Get("Content-Type")
+	if cType == "" && r.ContentLength == 0 {
+		return nil
+	}
 	if idx := strings.Index(cType, ";"); idx != -1 {
 		cType = cType[0:idx]
 	}
@@ -111,128 +156,102 @@ func BindJson(r *http.Request, out interface{}) error {
 	return nil
 }
 
-// BindQuery puts all query string values into struct fields with tag:"query"
+// BindQuery puts all query string values into struct fields with tag:"query",
+// slices also read keys ending with []. Keys such as address.city,
+// items[0].sku and filter[status] bind nested structs, slices and maps.
 func BindQuery(r *http.Request, out interface{}) error {
-	t := reflect.TypeOf(out)
-	v := reflect.ValueOf(out)
-	if t.Kind() == reflect.Ptr {
-		v = v.Elem()
+	v, ok := structValue(out)
+	if !ok {
+		return nil
 	}
-	toTypeSlice := func(vals reflect.Value, sliceType reflect.Type) interface{} {
-		if sliceType == stringSlice {
-			return vals.Interface()
-		}
-		newVals := reflect.New(sliceType).Elem()
-		for i := 0; i < vals.Len(); i++ {
-			val := vals.Index(i).String()
-			var v interface{}
-			switch sliceType {
-			case intSlice:
-				v, _ = strconv.Atoi(val)
-			case int64Slice:
-				v, _ = strconv.ParseInt(val, 10, 64)
-			default:
-				v = nil
-			}
-			if v != nil {
-				newVals = reflect.Append(newVals, reflect.ValueOf(v))
-			}
+	return bindValues(v, "query", r.URL.Query(), "query param")
+}
+
+// BindPath puts all route params into struct fields with tag:"path"
+func BindPath(r *http.Request, out interface{}) error {
+	st := getState(r.Context())
+	if st == nil || len(st.params) == 0 {
+		return nil
+	}
+	return bindFields(out, "path", "path param", func(name string) []string {
+		if p, ok := st.param(name); ok {
+			return []string{p}
 		}
-		return newVals.Interface()
-	}
-	for _, field := range structtag.GetFieldsByTag(out, "query") {
-		tag := field.Tag
-		if q := Query(r, tag); q != "" {
-			vv := v.Field(field.Index)
-			vk := vv.Kind()
-			if vk != reflect.String {
-				var val interface{}
-				switch vk {
-				case reflect.Int:
-					val, _ = strconv.Atoi(q)
-				case reflect.Int64:
-					val, _ = strconv.ParseInt(q, 10, 64)
-				case reflect.Slice:
-					val = toTypeSlice(reflect.ValueOf(r.URL.Query()[tag]), vv.Type())
-				}
-				vv.Set(reflect.ValueOf(val))
-			} else {
-				vv.Set(reflect.ValueOf(q))
+		return nil
+	})
+}
+
+// BindHeader puts all request headers into struct fields with tag:"header"
+// such as header:"X-Request-Id", slices get every value of the header.
+func BindHeader(r *http.Request, out interface{}) error {
+	if len(r.Header) == 0 {
+		return nil
+	}
+	return bindFields(out, "header", "header", r.Header.Values)
+}
+
+// BindCookie puts all cookies into struct fields with tag:"cookie", slices
+// get every cookie with the name.
+func BindCookie(r *http.Request, out interface{}) error {
+	cookies := r.Cookies()
+	if len(cookies) == 0 {
+		return nil
+	}
+	return bindFields(out, "cookie", "cookie", func(name string) []string {
+		var vals []string
+		for _, c := range cookies {
+			if c.Name == name {
+				vals = append(vals, c.Value)
 			}
 		}
-	}
-	return nil
+		return vals
+	})
 }
 
-// BindForm puts all struct fields with tag:"form" from a form request
+// BindForm puts all struct fields with tag:"form" from a form request,
+// fields of *multipart.FileHeader and []*multipart.FileHeader get the
+// uploaded files. Slices also read keys ending with [] and nested keys work
+// like in BindQuery.
 func BindForm(r *http.Request, out interface{}) error {
-	t := reflect.TypeOf(out)
-	v := reflect.ValueOf(out)
-	if t.Kind() == reflect.Ptr {
-		v = v.Elem()
+	v, ok := structValue(out)
+	if !ok {
+		return nil
 	}
 	cType := r.Header.Get("Content-Type")
-	formValues := make(map[string]interface{})
+	var files map[string][]*multipart.FileHeader
 	if strings.HasPrefix(cType, "application/x-www-form-urlencoded") {
 		r.ParseForm()
-		for k := range r.PostForm {
-			formValues[k] = r.PostFormValue(k)
-		}
 	} else if strings.Contains(cType, "multipart/form-data") {
 		r.ParseMultipartForm(32 << 20)
-		for k := range r.PostForm {
-			formValues[k] = r.FormValue(k)
-		}
-		for k, v := range r.MultipartForm.File {
-			if strings.HasSuffix(k, "[]") {
-				formValues[k[:len(k)-2]] = v
-			} else {
-				formValues[k] = v[0]
-			}
+		if r.MultipartForm != nil {
+			files = r.MultipartForm.File
 		}
 	}
-	if len(formValues) == 0 {
+	if len(r.PostForm) == 0 && len(files) == 0 {
 		return nil
 	}
 	for _, field := range structtag.GetFieldsByTag(out, "form") {
-		tag := field.Tag
-		if formVal, ok := formValues[tag]; ok {
-			vv := v.Field(field.Index)
-			vk := vv.Kind()
-			var val interface{}
-			if vk == reflect.String {
-				if v, ok := formVal.(string); ok {
-					val = v
-				}
-			} else {
-				switch vk {
-				case reflect.Int:
-					v := formVal.(string)
-					val, _ = strconv.Atoi(v)
-				case reflect.Int64:
-					v := formVal.(string)
-					val, _ = strconv.ParseInt(v, 10, 64)
-				case reflect.Float64:
-					v := formVal.(string)
-					val, _ = strconv.ParseFloat(v, 64)
-				case reflect.Ptr:
-					if vv.Type() == typeMultipartFileHeader {
-						if fh, ok := formVal.(*multipart.FileHeader); ok {
-							val = fh
-						}
-					}
-				case reflect.Slice:
-					if vv.Type() == typeMultipartFileHeaderSlice {
-						val = formVal
-					}
-				}
+		vv := v.Field(field.Index)
+		switch vv.Type() {
+		case typeMultipartFileHeader:
+			if fhs := formValues(files, field.Tag); len(fhs) > 0 {
+				vv.Set(reflect.ValueOf(fhs[0]))
 			}
-			if val != nil {
-				vv.Set(reflect.ValueOf(val))
+		case typeMultipartFileHeaderSlice:
+			if fhs := formValues(files, field.Tag); len(fhs) > 0 {
+				vv.Set(reflect.ValueOf(fhs))
 			}
 		}
 	}
-	return nil
+	return bindValues(v, "form", r.PostForm, "form field")
+}
+
+// formValues returns the values of a form key or the key with [] appended
+func formValues[T any](form map[string][]T, key string) []T {
+	if vals, ok := form[key]; ok {
+		return vals
+	}
+	return form[key+"[]"]
 }
 
 func GetVals(ctx context.Context) map[string]interface{} {
@@ -272,6 +291,140 @@ func GetValue(r *http.Request, key string) interface{} {
 	return GetVal(r.Context(), key)
 }
 
+// isScalar reports whether t is a basic kind that can be parsed from a string
+func isScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// parseScalar converts a string into a value of a basic kind type, a
+// time.Duration, an encoding.TextUnmarshaler such as time.Time or a pointer
+// to one of those.
+func parseScalar(s string, t reflect.Type) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	if t.Kind() == reflect.Ptr {
+		elem, err := parseScalar(s, t.Elem())
+		if err != nil {
+			return v, err
+		}
+		v.Set(reflect.New(t.Elem()))
+		v.Elem().Set(elem)
+		return v, nil
+	}
+	if t == typeDuration {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return v, err
+		}
+		v.SetInt(int64(d))
+		return v, nil
+	}
+	if reflect.PointerTo(t).Implements(typeTextUnmarshaler) {
+		err := v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+		return v, err
+	}
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return v, err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		if t.Elem().Kind() != reflect.Uint8 {
+			return v, fmt.Errorf("unsupported type %s", t)
+		}
+		v.SetBytes([]byte(s))
+	default:
+		return v, fmt.Errorf("unsupported type %s", t)
+	}
+	return v, nil
+}
+
+// parseValues converts string values into a value of type t, slices get
+// every non empty value and other types the first one. ok is false when
+// there's no value so the field is left as is, pointers stay nil.
+func parseValues(vals []string, t reflect.Type) (v reflect.Value, ok bool, err error) {
+	if t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 && t != typeMultipartFileHeaderSlice {
+		v = reflect.MakeSlice(t, 0, len(vals))
+		for _, val := range vals {
+			if val == "" && t.Elem().Kind() != reflect.String {
+				continue
+			}
+			elem, err := parseScalar(val, t.Elem())
+			if err != nil {
+				return v, false, err
+			}
+			v = reflect.Append(v, elem)
+		}
+		return v, v.Len() > 0, nil
+	}
+	if len(vals) == 0 || vals[0] == "" {
+		return v, false, nil
+	}
+	v, err = parseScalar(vals[0], t)
+	return v, err == nil, err
+}
+
+// bindFields sets the struct fields with tag from the values returned by
+// lookup, a conversion error is a 400 naming the source and the tag value.
+func bindFields(out interface{}, tag, source string, lookup func(name string) []string) error {
+	v, ok := structValue(out)
+	if !ok {
+		return nil
+	}
+	for _, field := range structtag.GetFieldsByTag(out, tag) {
+		vv := v.Field(field.Index)
+		val, ok, err := parseValues(lookup(field.Tag), vv.Type())
+		if err != nil {
+			return Error{
+				Status:  http.StatusBadRequest,
+				Message: "invalid " + source + " " + field.Tag,
+				Err:     err,
+			}
+		}
+		if ok {
+			vv.Set(val)
+		}
+	}
+	return nil
+}
+
+// structValue returns the struct out points to
+func structValue(out interface{}) (reflect.Value, bool) {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return v, false
+	}
+	return v.Elem(), true
+}
+
 func refTypes(types ...reflect.Type) []reflect.Type {
 	return types
 }
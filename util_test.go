@@ -2,8 +2,14 @@ package restruct
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetSetValues(t *testing.T) {
@@ -87,3 +93,200 @@ func TestSetParams(t *testing.T) {
 		t.Errorf("Want id=42, got %v", got["id"])
 	}
 }
+
+type bindTypes struct {
+	Bool     bool          `query:"bool" form:"bool"`
+	Uint     uint          `query:"uint" form:"uint"`
+	Int32    int32         `query:"int32" form:"int32"`
+	Float32  float32       `query:"float32" form:"float32"`
+	IntPtr   *int          `query:"int_ptr" form:"int_ptr"`
+	NilPtr   *string       `query:"nil_ptr" form:"nil_ptr"`
+	Time     time.Time     `query:"time" form:"time"`
+	Duration time.Duration `query:"duration" form:"duration"`
+	Uints    []uint16      `query:"uints" form:"uints"`
+	Bytes    []byte        `query:"bytes" form:"bytes"`
+	Times    []time.Time   `query:"times" form:"times"`
+	Ptrs     []*int        `query:"ptrs" form:"ptrs"`
+	Strings  []string      `query:"strings" form:"strings"`
+}
+
+func TestBindTypes(t *testing.T) {
+	vals := url.Values{
+		"bool":     {"true"},
+		"uint":     {"7"},
+		"int32":    {"-3"},
+		"float32":  {"1.5"},
+		"int_ptr":  {"4"},
+		"time":     {"2024-01-02T03:04:05Z"},
+		"duration": {"1m30s"},
+		"uints[]":  {"1", "2"},
+		"bytes":    {"raw"},
+		"times":    {"2024-01-02T00:00:00Z", "", "2024-01-03T00:00:00Z"},
+		"ptrs":     {"5"},
+		"strings":  {"a", ""},
+	}
+	i4, i5 := 4, 5
+	want := bindTypes{
+		Bool:     true,
+		Uint:     7,
+		Int32:    -3,
+		Float32:  1.5,
+		IntPtr:   &i4,
+		Time:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Duration: 90 * time.Second,
+		Uints:    []uint16{1, 2},
+		Bytes:    []byte("raw"),
+		Times:    []time.Time{time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+		Ptrs:     []*int{&i5},
+		Strings:  []string{"a", ""},
+	}
+
+	var q bindTypes
+	r := httptest.NewRequest(http.MethodGet, "/?"+vals.Encode(), nil)
+	if err := BindQuery(r, &q); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(q, want) {
+		t.Errorf("BindQuery want %+v got %+v", want, q)
+	}
+
+	var f bindTypes
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(vals.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := BindForm(r, &f); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(f, want) {
+		t.Errorf("BindForm want %+v got %+v", want, f)
+	}
+
+	for query, msg := range map[string]string{
+		"bool=yes":          "invalid query param bool",
+		"uint=-1":           "invalid query param uint",
+		"int32=99999999999": "invalid query param int32",
+		"time=today":        "invalid query param time",
+		"duration=1x":       "invalid query param duration",
+		"ptrs=1&ptrs=x":     "invalid query param ptrs",
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		var e Error
+		err := BindQuery(r, &bindTypes{})
+		if !errors.As(err, &e) || e.Status != http.StatusBadRequest || e.Message != msg {
+			t.Errorf("%s: want 400 %s got %v", query, msg, err)
+		}
+	}
+
+}
+
+type (
+	bindAddress struct {
+		City string `form:"city" query:"city"`
+		Zip  *int   `form:"zip" query:"zip"`
+	}
+
+	bindItem struct {
+		SKU string `form:"sku" query:"sku"`
+		Qty int    `form:"qty" query:"qty"`
+	}
+
+	bindNested struct {
+		Name    string            `form:"name" query:"name"`
+		Address bindAddress       `form:"address" query:"address"`
+		Billing *bindAddress      `form:"billing" query:"billing"`
+		Ship    *bindAddress      `form:"ship" query:"ship"`
+		Items   []bindItem        `form:"items" query:"items"`
+		Refs    []*bindItem       `form:"refs" query:"refs"`
+		IDs     []int             `form:"ids" query:"ids"`
+		Filter  map[string]string `form:"filter" query:"filter"`
+		Counts  map[string][]int  `form:"counts" query:"counts"`
+		ByID    map[int]bindItem  `form:"by_id" query:"by_id"`
+	}
+)
+
+func TestBindNested(t *testing.T) {
+	vals := url.Values{
+		"name":           {"order"},
+		"address.city":   {"Paris"},
+		"address.zip":    {"75001"},
+		"billing.city":   {"Lyon"},
+		"items[0].sku":   {"a"},
+		"items[0].qty":   {"1"},
+		"items[2].sku":   {"c"},
+		"refs[0].sku":    {"r"},
+		"ids[1]":         {"20"},
+		"ids[0]":         {"10"},
+		"filter[status]": {"open"},
+		"filter[owner]":  {"me"},
+		"counts[a]":      {"1", "2"},
+		"by_id[7].qty":   {"3"},
+	}
+	zip := 75001
+	want := bindNested{
+		Name:    "order",
+		Address: bindAddress{City: "Paris", Zip: &zip},
+		Billing: &bindAddress{City: "Lyon"},
+		Items:   []bindItem{{SKU: "a", Qty: 1}, {}, {SKU: "c"}},
+		Refs:    []*bindItem{{SKU: "r"}},
+		IDs:     []int{10, 20},
+		Filter:  map[string]string{"status": "open", "owner": "me"},
+		Counts:  map[string][]int{"a": {1, 2}},
+		ByID:    map[int]bindItem{7: {Qty: 3}},
+	}
+
+	var q bindNested
+	r := httptest.NewRequest(http.MethodGet, "/?"+vals.Encode(), nil)
+	if err := BindQuery(r, &q); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(q, want) {
+		t.Errorf("BindQuery want %+v got %+v", want, q)
+	}
+
+	var f bindNested
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(vals.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := BindForm(r, &f); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(f, want) {
+		t.Errorf("BindForm want %+v got %+v", want, f)
+	}
+
+	for query, msg := range map[string]string{
+		"address.zip=x":                      "invalid query param address.zip",
+		"items[0].qty=x":                     "invalid query param items[0].qty",
+		"items[x].qty=1":                     "invalid query param items",
+		"items[1001].qty=1":                  "invalid query param items",
+		"items[1000].qty=1&refs[1000].qty=1": "invalid query param refs",
+		"by_id[x].qty=1":                     "invalid query param by_id[x]",
+		"counts[a]=1&counts[a]=x":            "invalid query param counts[a]",
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		var e Error
+		err := BindQuery(r, &bindNested{})
+		if !errors.As(err, &e) || e.Status != http.StatusBadRequest || e.Message != msg {
+			t.Errorf("%s: want 400 %s got %v", query, msg, err)
+		}
+	}
+	// existing pointers and slices are bound into
+	zip = 1
+	ref := &bindItem{SKU: "r", Qty: 2}
+	q = bindNested{
+		Billing: &bindAddress{City: "Lyon", Zip: &zip},
+		Refs:    []*bindItem{ref},
+		IDs:     []int{10, 20},
+	}
+	r = httptest.NewRequest(http.MethodGet, "/?billing.city=Paris&refs[1].sku=s&refs[0].qty=3&ids[0]=5", nil)
+	if err := BindQuery(r, &q); err != nil {
+		t.Fatal(err)
+	}
+	if q.Billing.City != "Paris" || q.Billing.Zip != &zip {
+		t.Errorf("BindQuery replaced billing %+v", q.Billing)
+	}
+	if len(q.Refs) != 2 || q.Refs[0] != ref || ref.Qty != 3 || q.Refs[1].SKU != "s" {
+		t.Errorf("BindQuery replaced refs %+v", q.Refs)
+	}
+	if !reflect.DeepEqual(q.IDs, []int{5, 20}) {
+		t.Errorf("BindQuery want ids [5 20] got %v", q.IDs)
+	}
+}
@@ -0,0 +1,316 @@
+package restruct
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/altlimit/restruct/structtag"
+)
+
+type (
+	// Rule validates a field value for a validate:"name=param" tag, v is
+	// never a pointer, nil pointers only run required.
+	Rule func(v reflect.Value, param string) bool
+
+	fieldRules struct {
+		index   int
+		name    string // json, form or query name of the field
+		rules   []fieldRule
+		nested  bool     // struct, pointer, slice or map with structs to check
+		empty   bool     // omitempty
+		unknown []string // rules that weren't registered when the plan was built
+	}
+
+	// fieldRule is looked up by name when it runs, so rules registered after
+	// the plan is built are used.
+	fieldRule struct {
+		name  string
+		param string
+	}
+)
+
+var (
+	rulesMu sync.RWMutex
+	rules   = map[string]Rule{
+		"required": func(v reflect.Value, _ string) bool { return !v.IsZero() },
+		"min": func(v reflect.Value, p string) bool {
+			return compareSize(v, p, func(a, b float64) bool { return a >= b })
+		},
+		"max": func(v reflect.Value, p string) bool {
+			return compareSize(v, p, func(a, b float64) bool { return a <= b })
+		},
+		"len": func(v reflect.Value, p string) bool {
+			return compareSize(v, p, func(a, b float64) bool { return a == b })
+		},
+		"email": isEmail,
+		"oneof": isOneOf,
+		"regex": matchRegex,
+	}
+	// validation plans by struct type
+	validateCache sync.Map
+	regexCache    sync.Map
+	// tags that name a field in validation errors, the first one set wins
+	nameTags = []string{"json", "form", "query", "path", "header", "cookie"}
+)
+
+// RegisterRule adds a named rule usable in validate tags such as
+// validate:"required,slug" or validate:"prefix=ab", it replaces built-in
+// rules with the same name. Rules registered after a handler is built are
+// used, but the handler reports them as unknown unless they're registered
+// before NewHandler.
+func RegisterRule(name string, fn Rule) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	rules[name] = fn
+}
+
+// Validate checks the validate tags of a struct and its nested structs. The
+// built-in rules are required, min, max, len (length of strings, slices and
+// maps or the value of numbers), email, oneof=a b and regex=^[a-z]+$, the
+// regex can't have a comma. omitempty skips the other rules for zero values.
+// It returns Error{Status: 400, Message: "validation error"} with Data as a
+// map of the json, form or query names to the first failed rule, nested
+// fields are named like address.city and items[0].sku. Unknown rules are
+// skipped, with the DefaultReader they're reported when the handler is built.
+func Validate(out interface{}) error {
+	v := reflect.ValueOf(out)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	failed := make(map[string]string)
+	validateValue(v, "", failed)
+	if len(failed) == 0 {
+		return nil
+	}
+	return Error{Status: http.StatusBadRequest, Message: "validation error", Data: failed}
+}
+
+// validateValue checks structs and the structs inside slices, arrays and maps
+func validateValue(v reflect.Value, prefix string, failed map[string]string) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			validateValue(v.Elem(), prefix, failed)
+		}
+	case reflect.Struct:
+		if prefix != "" {
+			prefix += "."
+		}
+		validateStruct(v, prefix, failed)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), prefix+"["+strconv.Itoa(i)+"]", failed)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			validateValue(iter.Value(), prefix+"["+fmt.Sprint(iter.Key().Interface())+"]", failed)
+		}
+	}
+}
+
+func validateStruct(v reflect.Value, prefix string, failed map[string]string) {
+	for _, fr := range structRules(v.Type()) {
+		fv := v.Field(fr.index)
+		name := prefix + fr.name
+		if !(fr.empty && fv.IsZero()) {
+			for _, r := range fr.rules {
+				if !r.check(fv) {
+					failed[name] = r.name
+					break
+				}
+			}
+		}
+		if fr.nested {
+			validateValue(fv, name, failed)
+		}
+	}
+}
+
+// check runs the rule on the value pointers point to, nil pointers only
+// fail required. Rules that aren't registered pass.
+func (r fieldRule) check(v reflect.Value) bool {
+	rulesMu.RLock()
+	fn, ok := rules[r.name]
+	rulesMu.RUnlock()
+	if !ok {
+		return true
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return r.name != "required"
+		}
+		v = v.Elem()
+	}
+	return fn(v, r.param)
+}
+
+// structRules returns the cached validation plan of a struct type
+func structRules(t reflect.Type) []*fieldRules {
+	if frs, ok := validateCache.Load(t); ok {
+		return frs.([]*fieldRules)
+	}
+	byIndex := make(map[int]*fieldRules)
+	for _, field := range structtag.GetFieldsByType(t, "validate") {
+		fr := &fieldRules{index: field.Index}
+		for _, key := range field.Keys {
+			if key == "omitempty" {
+				fr.empty = true
+				continue
+			}
+			rulesMu.RLock()
+			_, ok := rules[key]
+			rulesMu.RUnlock()
+			if !ok {
+				fr.unknown = append(fr.unknown, key)
+			}
+			checkParam(key, field.Tags[key])
+			fr.rules = append(fr.rules, fieldRule{name: key, param: field.Tags[key]})
+		}
+		byIndex[field.Index] = fr
+	}
+	var frs []*fieldRules
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		fr, ok := byIndex[i]
+		if !ok {
+			fr = &fieldRules{index: i}
+		}
+		fr.name = fieldName(f)
+		fr.nested = hasStructs(f.Type)
+		if len(fr.rules) == 0 && !fr.nested {
+			continue
+		}
+		frs = append(frs, fr)
+	}
+	validateCache.Store(t, frs)
+	return frs
+}
+
+// unknownRules builds the validation plans of t and the structs it holds,
+// so invalid params panic when the handler is built, and returns the rules
+// that aren't registered such as User.Age: gte.
+func unknownRules(t reflect.Type, seen map[reflect.Type]bool) (unknown []string) {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || !isNested(t) || seen[t] {
+		return
+	}
+	seen[t] = true
+	for _, fr := range structRules(t) {
+		for _, rule := range fr.unknown {
+			unknown = append(unknown, t.String()+"."+t.Field(fr.index).Name+": "+rule)
+		}
+		if fr.nested {
+			unknown = append(unknown, unknownRules(t.Field(fr.index).Type, seen)...)
+		}
+	}
+	return
+}
+
+// checkParam panics on invalid params of built-in rules
+func checkParam(rule, param string) {
+	switch rule {
+	case "min", "max", "len":
+		if _, err := strconv.ParseFloat(param, 64); err != nil {
+			panic("invalid validate param " + rule + "=" + param)
+		}
+	case "regex":
+		getRegex(param)
+	}
+}
+
+// fieldName returns the name of a field in validation errors
+func fieldName(f reflect.StructField) string {
+	for _, tag := range nameTags {
+		name, _, _ := strings.Cut(f.Tag.Get(tag), ",")
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+// hasStructs reports whether values of t can hold structs to validate
+func hasStructs(t reflect.Type) bool {
+	for {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			t = t.Elem()
+		case reflect.Interface:
+			return true
+		case reflect.Struct:
+			return isNested(t) && t != typeMultipartFileHeader.Elem()
+		default:
+			return false
+		}
+	}
+}
+
+// compareSize compares the length of strings, slices and maps or the value
+// of numbers against param.
+func compareSize(v reflect.Value, param string, cmp func(a, b float64) bool) bool {
+	n, _ := strconv.ParseFloat(param, 64)
+	switch v.Kind() {
+	case reflect.String:
+		return cmp(float64(utf8.RuneCountInString(v.String())), n)
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return cmp(float64(v.Len()), n)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cmp(float64(v.Int()), n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cmp(float64(v.Uint()), n)
+	case reflect.Float32, reflect.Float64:
+		return cmp(v.Float(), n)
+	}
+	return false
+}
+
+func isEmail(v reflect.Value, _ string) bool {
+	if v.Kind() != reflect.String {
+		return false
+	}
+	addr, err := mail.ParseAddress(v.String())
+	return err == nil && addr.Address == v.String()
+}
+
+func isOneOf(v reflect.Value, param string) bool {
+	s := fmt.Sprint(v.Interface())
+	for _, opt := range strings.Fields(param) {
+		if s == opt {
+			return true
+		}
+	}
+	return false
+}
+
+func matchRegex(v reflect.Value, param string) bool {
+	return getRegex(param).MatchString(fmt.Sprint(v.Interface()))
+}
+
+// getRegex returns the compiled regex, it panics on invalid ones
+func getRegex(expr string) *regexp.Regexp {
+	if re, ok := regexCache.Load(expr); ok {
+		return re.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		panic("invalid validate regex " + expr + ": " + err.Error())
+	}
+	regexCache.Store(expr, re)
+	return re
+}
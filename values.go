@@ -0,0 +1,213 @@
+package restruct
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/altlimit/restruct/structtag"
+)
+
+// MaxFormIndex is the highest slice index accepted in keys like items[0].sku,
+// it also caps the unset elements allocated for missing indexes in a bind.
+var MaxFormIndex = 1000
+
+// binder binds query or form values, gaps counts the slice elements
+// allocated for indexes that weren't sent.
+type binder struct {
+	tag    string
+	source string
+	values map[string][]string
+	gaps   int
+}
+
+// bindValues binds query or form values into the struct fields with tag.
+// Keys can reach into nested values: address.city for a struct field,
+// items[0].sku for a slice and filter[status] for a map.
+func bindValues(v reflect.Value, tag string, values map[string][]string, source string) error {
+	b := &binder{tag: tag, source: source, values: values}
+	_, err := b.bindStruct(v, "")
+	return err
+}
+
+// bindStruct binds the fields of a struct, prefix is the key of the struct
+// with a dot such as address. and empty at the top level.
+func (b *binder) bindStruct(v reflect.Value, prefix string) (bool, error) {
+	set := false
+	for _, field := range structtag.GetFieldsByType(v.Type(), b.tag) {
+		ok, err := b.bindValue(v.Field(field.Index), prefix+field.Tag)
+		if err != nil {
+			return false, err
+		}
+		set = set || ok
+	}
+	return set, nil
+}
+
+// bindValue binds the values of key into v, it reports whether v was set.
+// Existing pointers and slices are kept and bound into.
+func (b *binder) bindValue(v reflect.Value, key string) (bool, error) {
+	t := v.Type()
+	if t == typeMultipartFileHeader || t == typeMultipartFileHeaderSlice {
+		return false, nil
+	}
+	invalid := func(err error) error {
+		return Error{
+			Status:  http.StatusBadRequest,
+			Message: "invalid " + b.source + " " + key,
+			Err:     err,
+		}
+	}
+	switch {
+	case isNested(t):
+		return b.bindStruct(v, key+".")
+	case t.Kind() == reflect.Ptr && isNested(t.Elem()):
+		if !hasKeyPrefix(b.values, key+".") {
+			return false, nil
+		}
+		if !v.IsNil() {
+			return b.bindStruct(v.Elem(), key+".")
+		}
+		elem := reflect.New(t.Elem())
+		ok, err := b.bindStruct(elem.Elem(), key+".")
+		if ok {
+			v.Set(elem)
+		}
+		return ok, err
+	case t.Kind() == reflect.Map:
+		return b.bindMap(v, key)
+	}
+	nestedSlice := t.Kind() == reflect.Slice && (isNested(t.Elem()) || t.Elem().Kind() == reflect.Ptr && isNested(t.Elem().Elem()))
+	if !nestedSlice {
+		val, ok, err := parseValues(formValues(b.values, key), t)
+		if err != nil {
+			return false, invalid(err)
+		}
+		if ok {
+			v.Set(val)
+			return true, nil
+		}
+	}
+	if t.Kind() != reflect.Slice || t.Elem().Kind() == reflect.Uint8 {
+		return false, nil
+	}
+	// indexed keys such as items[0].sku or ids[0]
+	subs := subKeys(b.values, key)
+	if len(subs) == 0 {
+		return false, nil
+	}
+	indexes := make([]int, len(subs))
+	size := 0
+	for i, sub := range subs {
+		n, err := strconv.Atoi(sub)
+		if err != nil || n < 0 || n > MaxFormIndex {
+			return false, invalid(fmt.Errorf("invalid index %s", sub))
+		}
+		indexes[i] = n
+		size = max(size, n+1)
+	}
+	slice := v
+	if size > v.Len() {
+		b.gaps += size - len(subs)
+		if b.gaps > MaxFormIndex {
+			return false, invalid(fmt.Errorf("too many missing indexes"))
+		}
+		slice = reflect.MakeSlice(t, size, size)
+		reflect.Copy(slice, v)
+	}
+	set := false
+	for i, sub := range subs {
+		ok, err := b.bindValue(slice.Index(indexes[i]), key+"["+sub+"]")
+		if err != nil {
+			return false, err
+		}
+		set = set || ok
+	}
+	if set {
+		v.Set(slice)
+	}
+	return set, nil
+}
+
+// bindMap binds keys such as filter[status] into a map, the map key is
+// converted like any other value.
+func (b *binder) bindMap(v reflect.Value, key string) (bool, error) {
+	t := v.Type()
+	subs := subKeys(b.values, key)
+	if len(subs) == 0 {
+		return false, nil
+	}
+	m := v
+	if m.IsNil() {
+		m = reflect.MakeMapWithSize(t, len(subs))
+	}
+	set := false
+	for _, sub := range subs {
+		k, err := parseScalar(sub, t.Key())
+		if err != nil {
+			return false, Error{
+				Status:  http.StatusBadRequest,
+				Message: "invalid " + b.source + " " + key + "[" + sub + "]",
+				Err:     err,
+			}
+		}
+		elem := reflect.New(t.Elem()).Elem()
+		ok, err := b.bindValue(elem, key+"["+sub+"]")
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			m.SetMapIndex(k, elem)
+			set = true
+		}
+	}
+	if set {
+		v.Set(m)
+	}
+	return set, nil
+}
+
+// isNested reports whether t is a struct bound field by field
+func isNested(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && !reflect.PointerTo(t).Implements(typeTextUnmarshaler)
+}
+
+// hasKeyPrefix reports whether a key starts with prefix
+func hasKeyPrefix(values map[string][]string, prefix string) bool {
+	for k := range values {
+		if strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// subKeys returns the sorted distinct K of keys like key[K] and key[K].name,
+// key[] isn't included as it's a list of values.
+func subKeys(values map[string][]string, key string) []string {
+	var subs []string
+	seen := make(map[string]bool)
+	prefix := key + "["
+	for k := range values {
+		rest, ok := strings.CutPrefix(k, prefix)
+		if !ok {
+			continue
+		}
+		idx := strings.IndexByte(rest, ']')
+		if idx < 1 {
+			continue
+		}
+		if after := rest[idx+1:]; after != "" && after[0] != '.' && after[0] != '[' {
+			continue
+		}
+		if sub := rest[:idx]; !seen[sub] {
+			seen[sub] = true
+			subs = append(subs, sub)
+		}
+	}
+	sort.Strings(subs)
+	return subs
+}
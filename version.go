@@ -0,0 +1,114 @@
+package restruct
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Versioned interface sets the API version of a service and its nested
+	// services, same as a version:"2" tag on the field. It's not named
+	// Version so services can have a Version route.
+	Versioned interface {
+		APIVersion() int
+	}
+)
+
+// GetVersion returns the API version of the service that served the request,
+// 0 if the route isn't versioned.
+func GetVersion(ctx context.Context) int {
+	if st := getState(ctx); st != nil {
+		return st.version
+	}
+	return 0
+}
+
+// parseVersion parses a version tag, it panics on anything but a positive int
+func parseVersion(tag string) int {
+	v, err := strconv.Atoi(strings.TrimPrefix(tag, "v"))
+	if err != nil || v <= 0 {
+		panic("invalid version " + tag)
+	}
+	return v
+}
+
+// setVersion sets the version of methods that don't have one yet, so the
+// innermost version wins.
+func setVersion(methods []*method, version int) {
+	if version == 0 {
+		return
+	}
+	for _, m := range methods {
+		if m.version == 0 {
+			m.version = version
+		}
+	}
+}
+
+// requestVersion returns the version asked by the request from VersionHeader
+// or the Accept header such as application/vnd.app.v2+json or
+// application/json; version=2, it's DefaultVersion when there's none.
+func (h *Handler) requestVersion(r *http.Request) int {
+	if h.VersionHeader != "" {
+		if v := r.Header.Get(h.VersionHeader); v != "" {
+			if n, err := strconv.Atoi(strings.TrimPrefix(v, "v")); err == nil {
+				return n
+			}
+		}
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		if v, ok := params["version"]; ok {
+			if n, err := strconv.Atoi(v); err == nil {
+				return n
+			}
+		}
+		// application/vnd.app.v2+json
+		sub := mt[strings.IndexByte(mt, '/')+1:]
+		if !strings.HasPrefix(sub, "vnd.") {
+			continue
+		}
+		if idx := strings.IndexByte(sub, '+'); idx != -1 {
+			sub = sub[:idx]
+		}
+		if idx := strings.LastIndex(sub, ".v"); idx != -1 {
+			if n, err := strconv.Atoi(sub[idx+2:]); err == nil {
+				return n
+			}
+		}
+	}
+	return h.DefaultVersion
+}
+
+// matchVersion drops the versioned methods newer than the request version,
+// 0 means the newest. Newer versions come first (see addMethod) so the first
+// method accepting the request method is the newest one that's not too new.
+func (h *Handler) matchVersion(ms []*method, r *http.Request) []*method {
+	versioned := false
+	for _, m := range ms {
+		if m.version > 0 {
+			versioned = true
+			break
+		}
+	}
+	if !versioned {
+		return ms
+	}
+	version := h.requestVersion(r)
+	if version == 0 {
+		return ms
+	}
+	out := make([]*method, 0, len(ms))
+	for _, m := range ms {
+		if m.version <= version {
+			out = append(out, m)
+		}
+	}
+	return out
+}
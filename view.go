@@ -2,7 +2,6 @@ package restruct
 
 import (
 	"bytes"
-	"context"
 	"fmt"
 	"html/template"
 	"io"
@@ -37,7 +36,8 @@ type (
 		// If nil, it will use the Handler's writer if available, or default to DefaultWriter.
 		Writer ResponseWriter
 
-		prefix  string // service route prefix, set by Handler for nested struct views
+		prefix  string   // service route prefix, set by Handler for nested struct views
+		handler *Handler // owning handler, set by Handler for the url template func
 		cache   map[string]*viewCache
 		routes  map[string]string
 		cacheMu sync.RWMutex
@@ -146,8 +146,8 @@ func (v *View) Write(w http.ResponseWriter, r *http.Request, types []reflect.Typ
 
 	// Check if we have a route pattern in context
 	var routeMatch string
-	if route, ok := r.Context().Value(keyRoute).(string); ok {
-		routeKey := strings.TrimPrefix(route, "/")
+	if route := GetRoute(r.Context()); route != nil {
+		routeKey := strings.TrimPrefix(route.Path, "/")
 		if v.prefix != "" {
 			routeKey = strings.TrimPrefix(routeKey, v.prefix)
 		}
@@ -187,16 +187,14 @@ func (v *View) Write(w http.ResponseWriter, r *http.Request, types []reflect.Typ
 		// so they are available to the view.
 		if len(fallbackParams) > 0 {
 			ctx := r.Context()
-			existingParams, _ := ctx.Value(keyParams).(map[string]string)
 			newParams := make(map[string]string)
-			for k, v := range existingParams {
+			for k, v := range Vars(ctx) {
 				newParams[k] = v
 			}
 			for k, v := range fallbackParams {
 				newParams[k] = v
 			}
-			ctx = context.WithValue(ctx, keyParams, newParams)
-			r = r.WithContext(ctx)
+			r = r.WithContext(SetVars(ctx, newParams))
 		}
 	}
 
@@ -226,7 +224,8 @@ func (v *View) Write(w http.ResponseWriter, r *http.Request, types []reflect.Typ
 
 	if fileName == "" {
 		// Not found in view
-		isAny, _ := r.Context().Value(keyIsAny).(bool)
+		st := getState(r.Context())
+		isAny := st != nil && st.isAny
 		if v.Error != "" && isAny {
 			// Try to serve error template
 			fileName = v.Error
@@ -305,8 +304,8 @@ func (v *View) getTemplate(fileName string, modTime time.Time) (*template.Templa
 	// 2. Cache miss or stale - Prepare to Parse
 	// We do parsing OUTSIDE the lock to allow concurrency for other requests serving cached content.
 
-	// Create a new template bucket
-	tmpl := template.New("").Funcs(v.Funcs)
+	// Create a new template bucket, user Funcs can override the built-in ones
+	tmpl := template.New("").Funcs(template.FuncMap{"url": v.url}).Funcs(v.Funcs)
 
 	// Helper to read and parse a file into the template set
 	parseFile := func(name string) error {
@@ -389,6 +388,35 @@ func (v *View) getLayoutModTime() (time.Time, error) {
 	return maxTime, nil
 }
 
+// url is the template func for Handler.URL, params are given as
+// name, value pairs or a single map: {{ url "User.ReadUser" "id" .ID }}
+func (v *View) url(name string, args ...any) (string, error) {
+	if v.handler == nil {
+		return "", fmt.Errorf("url: view is not registered to a handler")
+	}
+	params := make(map[string]string)
+	if len(args) == 1 {
+		switch m := args[0].(type) {
+		case map[string]string:
+			params = m
+		case map[string]any:
+			for k, val := range m {
+				params[k] = fmt.Sprint(val)
+			}
+		default:
+			return "", fmt.Errorf("url: params must be a map or name, value pairs")
+		}
+	} else {
+		if len(args)%2 != 0 {
+			return "", fmt.Errorf("url: params must be name, value pairs")
+		}
+		for i := 0; i < len(args); i += 2 {
+			params[fmt.Sprint(args[i])] = fmt.Sprint(args[i+1])
+		}
+	}
+	return v.handler.URL(name, params)
+}
+
 func (v *View) viewData(r *http.Request, data any) map[string]any {
 	var viewData map[string]any
 
@@ -400,9 +428,9 @@ func (v *View) viewData(r *http.Request, data any) map[string]any {
 	}
 
 	viewData["Request"] = r
-	if params, ok := r.Context().Value(keyParams).(map[string]string); ok {
-		for k, v := range params {
-			viewData[k] = v
+	if st := getState(r.Context()); st != nil {
+		for _, p := range st.params {
+			viewData[p.name] = p.value
 		}
 	}
 